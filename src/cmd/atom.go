@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	URI   string `xml:"uri,omitempty"`
+}
+
+type AtomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type AtomFeedLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type AtomEntry struct {
+	XMLName         xml.Name       `xml:"entry"`
+	ID              string         `xml:"id"`
+	Title           string         `xml:"title"`
+	Updated         string         `xml:"updated"`
+	Published       string         `xml:"published"`
+	PublishedAsDate time.Time      `xml:"-"`
+	UpdatedAsDate   time.Time      `xml:"-"`
+	Author          *AtomPerson    `xml:"author,omitempty"`
+	Links           []AtomFeedLink `xml:"link"`
+	Categories      []AtomCategory `xml:"category"`
+	Summary         *AtomText      `xml:"summary,omitempty"`
+	Content         *AtomText      `xml:"content,omitempty"`
+}
+
+type AtomFeed struct {
+	XMLName   xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Subtitle  string         `xml:"subtitle,omitempty"`
+	Updated   string         `xml:"updated"`
+	Links     []AtomFeedLink `xml:"link"`
+	Author    *AtomPerson    `xml:"author,omitempty"`
+	Generator string         `xml:"generator"`
+	Rights    string         `xml:"rights"`
+	Entries   []AtomEntry    `xml:"entry"`
+}
+
+var webmasterFormat = regexp.MustCompile(`^\s*(\S+@\S+)\s*\((.*)\)\s*$`)
+
+// webmasterPerson turns the RSS style "email (Name)" webmaster into the feed author
+func webmasterPerson() *AtomPerson {
+	if matches := webmasterFormat.FindStringSubmatch(ConfigData.Metadata.Webmaster); matches != nil {
+		return &AtomPerson{Name: matches[2], Email: matches[1], URI: ConfigData.BaseURL}
+	}
+	return &AtomPerson{Name: ConfigData.Metadata.Title, URI: ConfigData.BaseURL}
+}
+
+// WriteAtom writes the feed as Atom 1.0 into the BaseDir, newest entries
+// first and no more than limit of them if limit isn't -1
+func WriteAtom(feed AtomFeed, filename string, limit int) error {
+	selfLink, _ := url.JoinPath(ConfigData.BaseURL, filename)
+	feed.ID = selfLink
+	if feed.Title == "" {
+		feed.Title = ConfigData.Metadata.Title
+		feed.Subtitle = ConfigData.Metadata.Description
+	}
+	feed.Links = append(feed.Links, AtomFeedLink{Href: selfLink, Rel: "self", Type: "application/atom+xml"})
+	for _, hub := range hubLinks() {
+		feed.Links = append(feed.Links, AtomFeedLink{Href: hub.Href, Rel: hub.Rel})
+	}
+	feed.Author = webmasterPerson()
+	feed.Generator = "Ridiculous Go Homebrew"
+	feed.Rights = "Creative Commons 3.0 with Attribution"
+
+	sort.SliceStable(feed.Entries, func(p, q int) bool {
+		return feed.Entries[p].PublishedAsDate.After(feed.Entries[q].PublishedAsDate)
+	})
+	if limit > -1 {
+		limit = min(limit, len(feed.Entries))
+		feed.Entries = feed.Entries[0:limit]
+	}
+	// The feed changes when one of its entries does
+	updated := DateOfExecution
+	for i, entry := range feed.Entries {
+		if i == 0 || entry.UpdatedAsDate.After(updated) {
+			updated = entry.UpdatedAsDate
+		}
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+
+	byteValue, err := xml.MarshalIndent(feed, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFeed(filename, append([]byte(xml.Header), byteValue...), true)
+}
+
+// PostsToAtom is the Atom feed of the posts, linking to the list page it goes with
+func PostsToAtom(posts []FrontMatter, title string, description string, alternate string) AtomFeed {
+	feed := AtomFeed{
+		Title:    title,
+		Subtitle: description,
+		Links:    []AtomFeedLink{{Href: alternate, Rel: "alternate", Type: "text/html"}},
+		Entries:  make([]AtomEntry, 0, len(posts)),
+	}
+	for _, post := range posts {
+		feed.Entries = append(feed.Entries, PostToEntry(post))
+	}
+	return feed
+}
+
+func PostToEntry(frontmatter FrontMatter) AtomEntry {
+	updated := frontmatter.UpdatedDate
+	if updated.IsZero() || updated.Before(frontmatter.CreatedDate) {
+		updated = frontmatter.CreatedDate
+	}
+	entry := AtomEntry{
+		ID:              frontmatter.Link,
+		Title:           frontmatter.Title,
+		Updated:         updated.Format(time.RFC3339),
+		Published:       frontmatter.CreatedDate.Format(time.RFC3339),
+		PublishedAsDate: frontmatter.CreatedDate,
+		UpdatedAsDate:   updated,
+		Links:           []AtomFeedLink{{Href: frontmatter.Link, Rel: "alternate", Type: "text/html"}},
+		Categories:      make([]AtomCategory, 0, len(frontmatter.Tags)),
+	}
+	if frontmatter.Author != "" {
+		entry.Author = &AtomPerson{Name: frontmatter.Author}
+	}
+	for _, tag := range frontmatter.Tags {
+		entry.Categories = append(entry.Categories, AtomCategory{Term: strings.ToLower(tag), Label: tag})
+	}
+	if frontmatter.Synopsis != "" {
+		entry.Summary = &AtomText{Type: "text", Body: frontmatter.Synopsis}
+	}
+	if frontmatter.Content != "" {
+		entry.Content = &AtomText{Type: "html", Body: frontmatter.Content}
+	}
+	return entry
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAtom(t *testing.T) {
+	keepConfig(t)
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Title = "Professor von Explaino"
+	ConfigData.Metadata.Webmaster = `professor@vonexplaino.com (Colin Morris)`
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "tag"), 0755)
+	older, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	newer, _ := time.Parse(time.RFC3339, "2024-05-02T10:00:00+10:00")
+	edited, _ := time.Parse(time.RFC3339, "2024-06-01T10:00:00+10:00")
+	posts := []FrontMatter{
+		{Title: "Older", Link: "https://vonexplaino.com/blog/posts/article/2024/05/older.html", Tags: []string{"Code"}, CreatedDate: older, UpdatedDate: edited, Synopsis: "Old one", Content: "<p>Old <b>one</b></p>"},
+		{Title: "Newer", Link: "https://vonexplaino.com/blog/posts/article/2024/05/newer.html", Tags: []string{"Code"}, CreatedDate: newer, Author: "Someone"},
+	}
+
+	err := WriteAtom(PostsToAtom(posts, "Tagged Code", "Code posts", "https://vonexplaino.com/blog/tag/code-1.html"), "tag/code.atom", -1)
+	if err != nil {
+		t.Fatalf("Failed to write the feed %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "tag/code.atom"))
+	var feed AtomFeed
+	if err = xml.Unmarshal(content, &feed); err != nil {
+		t.Fatalf("Not valid XML %v\n%s", err, content)
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" || feed.Title != "Tagged Code" || feed.ID != "https://vonexplaino.com/blog/tag/code.atom" {
+		t.Fatalf("Wrong feed %v", feed)
+	}
+	if len(feed.Links) != 2 || feed.Links[0].Rel != "alternate" || feed.Links[1].Href != "https://vonexplaino.com/blog/tag/code.atom" {
+		t.Fatalf("Wrong links %v", feed.Links)
+	}
+	if feed.Updated != edited.Format(time.RFC3339) || feed.Author.Name != "Colin Morris" {
+		t.Fatalf("Wrong updated or author %s %v", feed.Updated, feed.Author)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "Newer" || feed.Entries[0].Author.Name != "Someone" {
+		t.Fatalf("Wrong entries %v", feed.Entries)
+	}
+	old := feed.Entries[1]
+	if old.Updated != edited.Format(time.RFC3339) || old.Published != older.Format(time.RFC3339) ||
+		old.Content.Type != "html" || old.Content.Body != "<p>Old <b>one</b></p>" || old.Categories[0].Term != "code" {
+		t.Fatalf("Wrong entry %v", old)
+	}
+
+	WriteAtom(PostsToAtom(posts, "", "", ConfigData.BaseURL), "atom.xml", 1)
+	content, _ = os.ReadFile(filepath.Join(ConfigData.BaseDir, "atom.xml"))
+	feed = AtomFeed{}
+	xml.Unmarshal(content, &feed)
+	if len(feed.Entries) != 1 || feed.Title != "Professor von Explaino" {
+		t.Fatalf("Limit or default title not applied %v", feed)
+	}
+}
@@ -2,64 +2,218 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 )
 
+// blueskySyndicator crossposts to a Bluesky account
+type blueskySyndicator struct {
+	config Bluesky
+}
+
+func newBlueskySyndicator(config Syndics) (Syndicator, bool) {
+	return &blueskySyndicator{config: config.Bluesky}, config.Bluesky.URL != ""
+}
+
+func init() {
+	registerSyndicator(newBlueskySyndicator)
+}
+
+func (s *blueskySyndicator) Name() string {
+	return "Bluesky"
+}
+
+func (s *blueskySyndicator) Wants(frontmatter FrontMatter) bool {
+	return postWantsBlueskyCrosspost(frontmatter)
+}
+
+// Format is the text and link facets of makeBlueskyPost. Posts that link
+// back to the blog get a card for the link, others their images.
+func (s *blueskySyndicator) Format(frontmatter *FrontMatter) SyndicationMessage {
+	text, facets := makeBlueskyPost(frontmatter)
+	message := SyndicationMessage{Text: text, Facets: facets, CreatedAt: frontmatter.CreatedDate}
+	if blueskyLinksToPost(frontmatter) {
+		message.Card = &SyndicationCard{
+			Link:        frontmatter.Link,
+			Title:       frontmatter.Title,
+			Description: frontmatter.Synopsis,
+			Image:       frontmatter.FeatureImage,
+		}
+		return message
+	}
+	for _, media := range syndicationMedia(frontmatter) {
+		if len(message.Media) < blueskyImageLimit && contains(blueskyImageTypes, media.Type) {
+			message.Media = append(message.Media, media)
+		}
+	}
+	return message
+}
+
+// Bluesky takes up to four images a post, of no more than about a megabyte
+var blueskyImageLimit = 4
+var blueskyBlobLimit int64 = 1000000
+var blueskyImageTypes = []string{"image/jpeg", "image/png", "image/webp", "image/gif"}
+
+// blueskyLinksToPost is true for the posts whose crosspost is a link back to
+// the blog, rather than the whole post
+func blueskyLinksToPost(frontmatter *FrontMatter) bool {
+	posttype := strings.ToLower(frontmatter.Type)
+	return posttype != "indieweb" && posttype != "tweet" && posttype != "toot"
+}
+
+func (s *blueskySyndicator) RecordLink(filename string, frontmatter *FrontMatter, link string) error {
+	frontmatter.SyndicationLinks.Bluesky = link
+	return setBlueskyLink(filename, link)
+}
+
 func postWantsBlueskyCrosspost(fm FrontMatter) bool {
-	return fm.SyndicationLinks.Bluesky == "XPOST"
+	return wantsSyndication(fm.SyndicationLinks.Bluesky)
+}
+
+func setBlueskyLink(filename string, link string) error {
+	return setSyndicationLink(filename, "Bluesky", link)
+}
+
+// blueskySessionFilename holds the last session's tokens, in the TempDir, so
+// each post doesn't log in again
+var blueskySessionFilename = "bluesky-session.json"
+
+// Tokens are refreshed when they have less than this left
+var blueskyTokenMargin = time.Minute
+
+// blueskySession is a logged in session, for the account on the server
+type blueskySession struct {
+	URL        string `json:"url"`
+	Userid     string `json:"userid"`
+	AccessJWT  string `json:"accessJwt"`
+	RefreshJWT string `json:"refreshJwt"`
 }
 
-func setBlueskyLink(filename string, link string) {
-	filename = filepath.Join(ConfigData.RepositoryDir, filename)
-	mep, err := os.ReadFile(filename)
-	if err == nil {
-		replc := regexp.MustCompile(`Bluesky:[ '"]*XPOST[ '"]*`)
-		mep := replc.ReplaceAll(mep, []byte(fmt.Sprintf(`Bluesky: "%s"`, link)))
-		os.WriteFile(filename, mep, 0777)
+// login returns the access token of the saved session if it's still good,
+// refreshing or starting a session if not
+func (s *blueskySyndicator) login() (string, error) {
+	saved, err := s.loadSession()
+	if err == nil && tokenLive(saved.AccessJWT) {
+		return saved.AccessJWT, nil
+	}
+	session := blueskySession{}
+	if err == nil && tokenLive(saved.RefreshJWT) {
+		session, err = s.session("com.atproto.server.refreshSession", nil, saved.RefreshJWT)
+		if err != nil {
+			PrintIfNotSilent(fmt.Sprintf("Could not refresh the bluesky session %v\n", err))
+		}
 	}
+	if session.AccessJWT == "" {
+		buffer, _ := json.Marshal(struct {
+			Identifier string `json:"identifier"`
+			Password   string `json:"password"`
+		}{Identifier: s.config.Userid, Password: s.config.Password})
+		session, err = s.session("com.atproto.server.createSession", buffer, "")
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := s.saveSession(session); err != nil {
+		PrintIfNotSilent(fmt.Sprintf("Could not save the bluesky session %v\n", err))
+	}
+	return session.AccessJWT, nil
 }
 
-func loginToBluesky() string {
+// session calls createSession or refreshSession, returning the new tokens
+func (s *blueskySyndicator) session(method string, body []byte, token string) (blueskySession, error) {
 	type blueskyLoginResponse struct {
 		AccessJWT  string `json:"accessJwt"`
 		RefreshJWT string `json:"refreshJwt"`
 	}
 
-	buffer, _ := json.Marshal(struct {
-		Identifier string `json:"identifier"`
-		Password   string `json:"password"`
-	}{Identifier: ConfigData.Syndication.Bluesky.Userid, Password: ConfigData.Syndication.Bluesky.Password})
 	request, _ := http.NewRequest(
 		"POST",
-		ConfigData.Syndication.Bluesky.URL+"xrpc/com.atproto.server.createSession",
-		bytes.NewBuffer(buffer),
+		s.config.URL+"xrpc/"+method,
+		bytes.NewBuffer(body),
 	)
 	request.Header.Set("Content-type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
 	resp, err := Client.Do(request)
 	if err != nil {
-		log.Fatal(err.Error())
+		return blueskySession{}, err
 	}
+	defer resp.Body.Close()
 
 	var res blueskyLoginResponse
 	json.NewDecoder(resp.Body).Decode(&res)
 	if resp.StatusCode != 200 {
-		log.Fatalf("status code was %d", resp.StatusCode)
+		return blueskySession{}, fmt.Errorf("failed to log in to bluesky [%d]", resp.StatusCode)
 	}
-	if res.AccessJWT != "" {
-		return res.AccessJWT
-	} else {
-		log.Fatalf("failed in post to bluesky attempt %s|%d", res, resp.StatusCode)
+	if res.AccessJWT == "" {
+		return blueskySession{}, fmt.Errorf("failed to log in to bluesky, no token %d", resp.StatusCode)
 	}
-	return ""
+	return blueskySession{URL: s.config.URL, Userid: s.config.Userid, AccessJWT: res.AccessJWT, RefreshJWT: res.RefreshJWT}, nil
+}
+
+func blueskySessionFile() string {
+	dir := ConfigData.TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, blueskySessionFilename)
+}
+
+// loadSession is the saved session, if it's for this account
+func (s *blueskySyndicator) loadSession() (blueskySession, error) {
+	var session blueskySession
+	content, err := os.ReadFile(blueskySessionFile())
+	if err != nil {
+		return session, err
+	}
+	if err = json.Unmarshal(content, &session); err != nil {
+		return session, err
+	}
+	if session.URL != s.config.URL || session.Userid != s.config.Userid {
+		return session, fmt.Errorf("saved session is for %s", session.Userid)
+	}
+	return session, nil
+}
+
+// saveSession keeps the tokens where only this user can read them
+func (s *blueskySyndicator) saveSession(session blueskySession) error {
+	content, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(blueskySessionFile(), content, 0600)
+}
+
+// tokenLive is true if the JWT doesn't expire for a while yet
+func tokenLive(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return false
+	}
+	var claims struct {
+		Expires int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Expires == 0 {
+		return false
+	}
+	return time.Unix(claims.Expires, 0).After(time.Now().Add(blueskyTokenMargin))
 }
 
 type indexStruct struct {
@@ -68,16 +222,43 @@ type indexStruct struct {
 }
 type featureStruct struct {
 	Type string `json:"$type"`
-	URI  string `json:"uri"`
+	URI  string `json:"uri,omitempty"`
+	Tag  string `json:"tag,omitempty"`
+	DID  string `json:"did,omitempty"`
 }
 type facetStruct struct {
 	Index    indexStruct     `json:"index"`
 	Features []featureStruct `json:"features"`
 }
 
+// Bluesky posts are at most 300 graphemes, and tags 64
+var blueskyGraphemeLimit = 300
+var blueskyTagLimit = 64
+
+// blueskyText is the text of a post with its facets, which index the text by
+// UTF-8 bytes
+type blueskyText struct {
+	text   string
+	facets []facetStruct
+}
+
+// add appends the text, as a facet if it has features
+func (b *blueskyText) add(text string, features ...featureStruct) {
+	start := len(b.text)
+	b.text += text
+	if len(features) > 0 {
+		b.facets = append(b.facets, facetStruct{
+			Index:    indexStruct{ByteStart: start, ByteEnd: len(b.text)},
+			Features: features,
+		})
+	}
+}
+
+// makeBlueskyPost is the synopsis, what the post replies to or links to, and
+// the tags, as text and its link and tag facets. The synopsis is shortened
+// so the whole fits in the grapheme limit.
 func makeBlueskyPost(frontmatter *FrontMatter) (string, []facetStruct) {
-	toSyndicate := frontmatter.Synopsis
-	facets := []facetStruct{}
+	tail := blueskyText{}
 	posttype := strings.ToLower(frontmatter.Type)
 	if posttype == "indieweb" {
 		prefix := "\n"
@@ -89,41 +270,182 @@ func makeBlueskyPost(frontmatter *FrontMatter) (string, []facetStruct) {
 			{frontmatter.BookmarkOf, "Bookmark of"},
 		} {
 			if len(x[0]) > 0 {
-				toSyndicate += prefix + "\n" + x[1] + ": "
+				tail.add(prefix + "\n" + x[1] + ": ")
 				prefix = ""
-				start := len(toSyndicate)
-				toSyndicate = toSyndicate + x[0]
-				facets = append(facets, facetStruct{
-					Index: indexStruct{
-						ByteStart: start,
-						ByteEnd:   len(toSyndicate),
-					},
-					Features: []featureStruct{
-						{Type: "app.bsky.richtext.facet#link", URI: x[0]},
-					},
-				})
+				tail.add(x[0], featureStruct{Type: "app.bsky.richtext.facet#link", URI: x[0]})
 			}
 		}
-	} else if posttype != "tweet" && posttype != "toot" {
-		start := len(toSyndicate)
-		toSyndicate = toSyndicate + "\r\n\r\n" + frontmatter.Link
+	} else if blueskyLinksToPost(frontmatter) {
+		tail.add("\r\n\r\n")
+		tail.add(frontmatter.Link, featureStruct{Type: "app.bsky.richtext.facet#link", URI: frontmatter.Link})
+	}
+	separator := "\n"
+	for _, tag := range frontmatter.Tags {
+		tag = strings.Join(strings.Fields(tag), "")
+		if tag == "" || graphemes(tag) > blueskyTagLimit || graphemes(tail.text)+graphemes(separator+"#"+tag) > blueskyGraphemeLimit {
+			continue
+		}
+		tail.add(separator)
+		tail.add("#"+tag, featureStruct{Type: "app.bsky.richtext.facet#tag", Tag: tag})
+		separator = " "
+	}
+
+	synopsis := truncateGraphemes(strings.Trim(frontmatter.Synopsis, " \n\r"), blueskyGraphemeLimit-graphemes(tail.text))
+	if synopsis == "" {
+		// Nothing to separate the rest from
+		trimmed := strings.TrimLeft(tail.text, " \n\r")
+		shift := len(tail.text) - len(trimmed)
+		for i := range tail.facets {
+			tail.facets[i].Index.ByteStart -= shift
+			tail.facets[i].Index.ByteEnd -= shift
+		}
+		tail.text = trimmed
+	}
+	post := blueskyText{}
+	post.add(synopsis)
+	for _, facet := range tail.facets {
+		facet.Index.ByteStart += len(synopsis)
+		facet.Index.ByteEnd += len(synopsis)
+		post.facets = append(post.facets, facet)
+	}
+	post.add(strings.TrimRight(tail.text, " \n\r"))
+	return post.text, post.facets
+}
+
+// truncateGraphemes shortens the text to at most limit graphemes, at a word
+// break if there's one, ending with an ellipsis
+func truncateGraphemes(text string, limit int) string {
+	if graphemes(text) <= limit {
+		return text
+	}
+	if limit < 1 {
+		return ""
+	}
+	runes := []rune(text)
+	end := 0
+	for count := 0; end < len(runes); end++ {
+		if !joinsPrevious(runes, end) {
+			if count == limit-1 {
+				break
+			}
+			count++
+		}
+	}
+	shortened := string(runes[:end])
+	if space := strings.LastIndexAny(shortened, " \n\t"); space > len(shortened)/2 {
+		shortened = shortened[:space]
+	}
+	return strings.TrimRight(shortened, " \n\t.,;:") + "…"
+}
+
+// graphemes counts the user-perceived characters in the text, as Bluesky
+// does: combining marks, variation selectors, skin tones and anything joined
+// by a zero width joiner belong to the character before them, and flags are
+// pairs of regional indicators
+func graphemes(text string) int {
+	runes := []rune(text)
+	count := 0
+	for i := range runes {
+		if !joinsPrevious(runes, i) {
+			count++
+		}
+	}
+	return count
+}
+
+func joinsPrevious(runes []rune, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r := runes[i]
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me), r == 0x200D, r >= 0xFE00 && r <= 0xFE0F, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		return true
+	case runes[i-1] == 0x200D:
+		return true
+	case r == '\n' && runes[i-1] == '\r':
+		return true
+	case isRegionalIndicator(r) && isRegionalIndicator(runes[i-1]):
+		// Only the second of each pair
+		pairs := 0
+		for j := i - 1; j >= 0 && isRegionalIndicator(runes[j]); j-- {
+			pairs++
+		}
+		return pairs%2 == 1
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// mentionPattern finds the @handle.domain mentions in a post
+var mentionPattern = regexp.MustCompile(`(^|\s)(@([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)+[a-zA-Z]([a-zA-Z0-9-]*[a-zA-Z0-9])?)`)
+
+// mentionFacets are the facets of the mentions in the text whose handles
+// resolve to an account; the rest stay plain text
+func (s *blueskySyndicator) mentionFacets(text string) []facetStruct {
+	facets := []facetStruct{}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		handle := text[match[4]+1 : match[5]]
+		did, err := s.resolveHandle(handle)
+		if err != nil {
+			PrintIfNotSilent(fmt.Sprintf("Not mentioning %s %v\n", handle, err))
+			continue
+		}
 		facets = append(facets, facetStruct{
-			Index: indexStruct{
-				ByteStart: start,
-				ByteEnd:   len(toSyndicate),
-			},
-			Features: []featureStruct{
-				{Type: "app.bsky.richtext.facet#link", URI: frontmatter.Link},
-			},
+			Index:    indexStruct{ByteStart: match[4], ByteEnd: match[5]},
+			Features: []featureStruct{{Type: "app.bsky.richtext.facet#mention", DID: did}},
 		})
 	}
-	if len(frontmatter.Tags) > 0 {
-		toSyndicate = toSyndicate + "\n#" + strings.Join(frontmatter.Tags, " #")
+	return facets
+}
+
+// resolveHandle is the DID of the account with the handle
+func (s *blueskySyndicator) resolveHandle(handle string) (string, error) {
+	request, _ := http.NewRequest(
+		"GET",
+		s.config.URL+"xrpc/com.atproto.identity.resolveHandle?handle="+url.QueryEscape(handle),
+		nil,
+	)
+	resp, err := Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		DID string `json:"did"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != 200 || res.DID == "" {
+		return "", fmt.Errorf("failed to resolve %s [%d]", handle, resp.StatusCode)
+	}
+	return res.DID, nil
+}
+
+// errBlueskySessionExpired is Bluesky turning down the session's token, which
+// the saved session can outlive
+var errBlueskySessionExpired = errors.New("bluesky session expired")
+
+// sessionExpired is true if the response turned down the token
+func sessionExpired(status int, body []byte) bool {
+	return status == http.StatusUnauthorized || bytes.Contains(body, []byte("ExpiredToken"))
+}
+
+// Post sends the message, logging in again and trying once more if the saved
+// session has expired
+func (s *blueskySyndicator) Post(message SyndicationMessage) (string, error) {
+	link, err := s.post(message)
+	if errors.Is(err, errBlueskySessionExpired) {
+		PrintIfNotSilent("Bluesky session expired, logging in again\n")
+		os.Remove(blueskySessionFile())
+		link, err = s.post(message)
 	}
-	return strings.Trim(toSyndicate, " \n\r"), facets
+	return link, err
 }
 
-func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (string, error) {
+func (s *blueskySyndicator) post(message SyndicationMessage) (string, error) {
 	type blueskyPostResponse struct {
 		URI string `json:"uri"`
 		Cid string `json:"cid"`
@@ -133,6 +455,7 @@ func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (s
 		Text      string        `json:"text"`
 		Facets    []facetStruct `json:"facets"`
 		CreatedAt string        `json:"createdAt"`
+		Embed     *blueskyEmbed `json:"embed,omitempty"`
 	}
 	type blueskyPostPackage struct {
 		Repo       string            `json:"repo"`
@@ -140,15 +463,25 @@ func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (s
 		Record     blueskyPostRecord `json:"record"`
 	}
 
-	token := loginToBluesky()
+	token, err := s.login()
+	if err != nil {
+		return "", err
+	}
+	embed, err := s.embed(token, message)
+	if err != nil {
+		return "", err
+	}
+	facets := append(append([]facetStruct{}, message.Facets...), s.mentionFacets(message.Text)...)
+	sort.Slice(facets, func(i, j int) bool { return facets[i].Index.ByteStart < facets[j].Index.ByteStart })
 
 	data := blueskyPostPackage{
-		Repo:       ConfigData.Syndication.Bluesky.Userid,
+		Repo:       s.config.Userid,
 		Collection: "app.bsky.feed.post",
 		Record: blueskyPostRecord{
-			Text:      message,
-			CreatedAt: createdAt.Format(time.RFC3339),
+			Text:      message.Text,
+			CreatedAt: message.CreatedAt.Format(time.RFC3339),
 			Facets:    facets,
+			Embed:     embed,
 		},
 	}
 	buffer, _ := json.Marshal(data)
@@ -156,7 +489,7 @@ func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (s
 
 	request, _ := http.NewRequest(
 		"POST",
-		ConfigData.Syndication.Bluesky.URL+"xrpc/com.atproto.repo.createRecord",
+		s.config.URL+"xrpc/com.atproto.repo.createRecord",
 		bytes.NewBuffer(buffer),
 	)
 	request.Header.Set(jsonHeaders[0][0], jsonHeaders[0][1])
@@ -168,7 +501,11 @@ func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (s
 	}
 	if resp.StatusCode != 200 {
 		respBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed in posting to bluesky %s[%d]", string(respBytes), resp.StatusCode)
+		err = fmt.Errorf("failed in posting to bluesky %s[%d]", string(respBytes), resp.StatusCode)
+		if sessionExpired(resp.StatusCode, respBytes) {
+			err = fmt.Errorf("%w, %v", errBlueskySessionExpired, err)
+		}
+		return "", err
 	}
 	var res blueskyPostResponse
 	json.NewDecoder(resp.Body).Decode(&res)
@@ -180,3 +517,126 @@ func postToBluesky(message string, facets []facetStruct, createdAt time.Time) (s
 		return "", fmt.Errorf("failed in post to bluesky attempt %s|%d", res, resp.StatusCode)
 	}
 }
+
+type blueskyExternal struct {
+	URI         string          `json:"uri"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Thumb       json.RawMessage `json:"thumb,omitempty"`
+}
+
+type blueskyImage struct {
+	Alt   string          `json:"alt"`
+	Image json.RawMessage `json:"image"`
+}
+
+type blueskyEmbed struct {
+	Type     string           `json:"$type"`
+	External *blueskyExternal `json:"external,omitempty"`
+	Images   []blueskyImage   `json:"images,omitempty"`
+}
+
+// embed is the link card or the images of the message, uploading the
+// thumbnail or images as blobs. Nil if there's nothing to embed.
+func (s *blueskySyndicator) embed(token string, message SyndicationMessage) (*blueskyEmbed, error) {
+	if message.Card != nil {
+		external := &blueskyExternal{URI: message.Card.Link, Title: message.Card.Title, Description: message.Card.Description}
+		// A card without a picture beats no card at all
+		if thumbnail, err := cardThumbnail(message.Card.Image); err == nil {
+			if external.Thumb, err = s.uploadBlob(token, thumbnail); errors.Is(err, errBlueskySessionExpired) {
+				return nil, err
+			} else if err != nil {
+				PrintIfNotSilent(fmt.Sprintf("Posting the card without its picture %v\n", err))
+				external.Thumb = nil
+			}
+		}
+		return &blueskyEmbed{Type: "app.bsky.embed.external", External: external}, nil
+	}
+	if len(message.Media) == 0 {
+		return nil, nil
+	}
+	embed := &blueskyEmbed{Type: "app.bsky.embed.images"}
+	for _, media := range message.Media {
+		if info, err := os.Stat(media.Filename); err == nil && info.Size() > blueskyBlobLimit {
+			// Too big for Bluesky, so send the thumbnail
+			thumbnail, err := cardThumbnail(media.Filename)
+			if err != nil {
+				return nil, fmt.Errorf("%s is too big for bluesky %v", filepath.Base(media.Filename), err)
+			}
+			thumbnail.Alt = media.Alt
+			media = thumbnail
+		}
+		blob, err := s.uploadBlob(token, media)
+		if err != nil {
+			return nil, err
+		}
+		embed.Images = append(embed.Images, blueskyImage{Alt: media.Alt, Image: blob})
+	}
+	return embed, nil
+}
+
+// uploadBlob sends the file to the account's repository, returning the blob
+// to reference it by
+func (s *blueskySyndicator) uploadBlob(token string, media SyndicationMedia) (json.RawMessage, error) {
+	content, err := os.ReadFile(media.Filename)
+	if err != nil {
+		return nil, err
+	}
+	request, _ := http.NewRequest(
+		"POST",
+		s.config.URL+"xrpc/com.atproto.repo.uploadBlob",
+		bytes.NewBuffer(content),
+	)
+	request.Header.Set("Content-type", media.Type)
+	request.Header.Set("Authorization", "Bearer "+token)
+	resp, err := Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	respBytes, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(respBytes, &res)
+	if resp.StatusCode != 200 || len(res.Blob) == 0 {
+		err = fmt.Errorf("failed to upload %s to bluesky [%d]", filepath.Base(media.Filename), resp.StatusCode)
+		if sessionExpired(resp.StatusCode, respBytes) {
+			err = fmt.Errorf("%w, %v", errBlueskySessionExpired, err)
+		}
+		return nil, err
+	}
+	return res.Blob, nil
+}
+
+// cardThumbnail makes the thumbnail of an image with makeThumbnail, in the
+// BaseDir beside the blog's copy of the image. The image is a link to the
+// site's media, or a file in the repository.
+func cardThumbnail(image string) (SyndicationMedia, error) {
+	filename, _, ok := mediaFile(image)
+	if !ok {
+		filename = image
+	}
+	relative, err := filepath.Rel(ConfigData.RepositoryDir, filename)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return SyndicationMedia{}, fmt.Errorf("%s isn't in the repository", image)
+	}
+	siteCopy := filepath.Join(ConfigData.BaseDir, relative)
+	if _, err := os.Stat(siteCopy); err != nil {
+		if err = FileCopy(filename, siteCopy); err != nil {
+			return SyndicationMedia{}, err
+		}
+	}
+	if err := defaultsForMe(); err != nil {
+		return SyndicationMedia{}, err
+	}
+	if ThumbnailOptions.Width == 0 || ThumbnailOptions.Height == 0 || ThumbnailOptions.Extension == "" {
+		return SyndicationMedia{}, fmt.Errorf("no thumbnail size in the config")
+	}
+	if err := makeThumbnail(siteCopy); err != nil {
+		return SyndicationMedia{}, err
+	}
+	thumbnail := getThumbnailFilename(siteCopy)
+	fileType, err := GetFileType(thumbnail)
+	return SyndicationMedia{Filename: thumbnail, Type: fileType}, err
+}
@@ -1,8 +1,19 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/colinmo/vonblog/utils/mocks"
 )
 
 func TestMakeBlueskyPost1(t *testing.T) {
@@ -27,7 +38,8 @@ func TestMakeBlueskyPost1(t *testing.T) {
 			expected,
 			synd)
 	}
-	if len(facets) > 0 {
+	if len(facets) != 1 || facets[0].Features[0].Type != "app.bsky.richtext.facet#tag" || facets[0].Features[0].Tag != "code" ||
+		synd[facets[0].Index.ByteStart:facets[0].Index.ByteEnd] != "#code" {
 		t.Fatalf("Darn I got facets of %v", facets)
 	}
 }
@@ -54,7 +66,236 @@ func TestMakeBlueskyPost2(t *testing.T) {
 			synd,
 			strings.Compare(synd, expected))
 	}
-	if len(facets) != 1 {
+	if len(facets) != 2 {
 		t.Fatalf("Darn I got the wrong number of facets: %v", facets)
 	}
 }
+
+func TestMakeBlueskyPostUnicodeAndLimit(t *testing.T) {
+	fm := FrontMatter{
+		Type:     `article`,
+		Synopsis: `Café ☕ for 👩‍🔬 in 🇦🇺 ` + strings.Repeat("and more words ", 30),
+		Link:     `https://vonexplaino.com/blog/posts/article/2024/11/06/café.html`,
+		Tags:     []string{"Ça va", "code"},
+	}
+	synd, facets := makeBlueskyPost(&fm)
+	if count := graphemes(synd); count > blueskyGraphemeLimit || count < blueskyGraphemeLimit-20 {
+		t.Fatalf("Wrong length %d\n%s", count, synd)
+	}
+	if !strings.HasPrefix(synd, "Café ☕ for 👩‍🔬 in 🇦🇺 and more") || !strings.Contains(synd, "more…\r\n\r\n"+fm.Link+"\n#Çava #code") {
+		t.Fatalf("Wrong truncation\n%s", synd)
+	}
+	expected := []string{fm.Link, "#Çava", "#code"}
+	if len(facets) != len(expected) {
+		t.Fatalf("Wrong facets %v", facets)
+	}
+	for i, facet := range facets {
+		if synd[facet.Index.ByteStart:facet.Index.ByteEnd] != expected[i] {
+			t.Fatalf("Facet %d is %s, not %s", i, synd[facet.Index.ByteStart:facet.Index.ByteEnd], expected[i])
+		}
+	}
+	if graphemes("👩‍🔬🇦🇺🇦🇺e\u0301\r\n") != 5 {
+		t.Fatalf("Wrong grapheme count %d", graphemes("👩‍🔬🇦🇺🇦🇺e\u0301\r\n"))
+	}
+
+	fm = FrontMatter{Type: `indieweb`, InReplyTo: `https://example.com/ü`}
+	synd, facets = makeBlueskyPost(&fm)
+	if synd != "In reply to: https://example.com/ü" || len(facets) != 1 || synd[facets[0].Index.ByteStart:facets[0].Index.ByteEnd] != fm.InReplyTo {
+		t.Fatalf("Wrong reply %s %v", synd, facets)
+	}
+}
+
+func TestBlueskyMentions(t *testing.T) {
+	previousClient := Client
+	t.Cleanup(func() { Client = previousClient })
+	target := &blueskySyndicator{config: Bluesky{URL: "https://bsky.example.com/"}}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("handle") == "friend.bsky.social" {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"did":"did:plc:friend"}`))}, nil
+		}
+		return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`{"error":"InvalidRequest"}`))}, nil
+	}
+	text := "Héllo @friend.bsky.social, and @nobody.example.com and me@vonexplaino.com"
+	facets := target.mentionFacets(text)
+	if len(facets) != 1 || facets[0].Features[0].DID != "did:plc:friend" || text[facets[0].Index.ByteStart:facets[0].Index.ByteEnd] != "@friend.bsky.social" {
+		t.Fatalf("Wrong mentions %v", facets)
+	}
+}
+
+func TestBlueskyEmbeds(t *testing.T) {
+	keepConfig(t)
+	previousClient := Client
+	previousThumbnails := ThumbnailOptions
+	t.Cleanup(func() {
+		Client = previousClient
+		ThumbnailOptions = previousThumbnails
+	})
+	var picture bytes.Buffer
+	png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"media/2024/05/one.png": picture.String(),
+		"media/2024/05/two.svg": `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.TempDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Thumbnails = Thumbnails{Width: 100, Height: 100, Extension: "_thumb.jpg"}
+	ThumbnailOptions = ThumbnailOptionsS{Type: "jpeg"}
+	target := &blueskySyndicator{config: Bluesky{URL: "https://bsky.example.com/", Userid: "vonexplaino.com"}}
+
+	uploads := []string{}
+	var record struct {
+		Record struct {
+			Embed blueskyEmbed `json:"embed"`
+		} `json:"record"`
+	}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		switch {
+		case strings.HasSuffix(req.URL.Path, "createSession"):
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"accessJwt":"token"}`))}, nil
+		case strings.HasSuffix(req.URL.Path, "uploadBlob"):
+			uploads = append(uploads, req.Header.Get("Content-type"))
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"blob":{"$type":"blob","ref":{"$link":"blob` + string(rune('0'+len(uploads))) + `"}}}`))}, nil
+		}
+		json.Unmarshal(body, &record)
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"uri":"at://did:plc:me/app.bsky.feed.post/abc"}`))}, nil
+	}
+
+	article := FrontMatter{Type: "article", Title: "Pictures", Synopsis: "Some pictures", Link: "https://vonexplaino.com/blog/posts/article/pictures.html", FeatureImage: "/blog/media/2024/05/one.png"}
+	link, err := target.Post(target.Format(&article))
+	if err != nil || link != "https://bsky.app/profile/vonexplaino.com/post/abc" {
+		t.Fatalf("Failed to post %s %v", link, err)
+	}
+	external := record.Record.Embed.External
+	if record.Record.Embed.Type != "app.bsky.embed.external" || external == nil || external.URI != article.Link ||
+		external.Title != "Pictures" || external.Description != "Some pictures" || !strings.Contains(string(external.Thumb), "blob1") {
+		t.Fatalf("Wrong card %v", record.Record.Embed)
+	}
+	if strings.Join(uploads, ",") != "image/jpeg" {
+		t.Fatalf("Card thumbnail not uploaded %v", uploads)
+	}
+
+	uploads = []string{}
+	toot := FrontMatter{Type: "toot", Synopsis: "A picture", Link: "https://vonexplaino.com/blog/posts/toot/picture.html",
+		AttachedMedia: []string{"/blog/media/2024/05/one.png", "/blog/media/2024/05/two.svg"},
+		MediaAlt:      map[string]string{"/blog/media/2024/05/one.png": "Nothing at all"}}
+	if _, err = target.Post(target.Format(&toot)); err != nil {
+		t.Fatalf("Failed to post %v", err)
+	}
+	images := record.Record.Embed.Images
+	if record.Record.Embed.Type != "app.bsky.embed.images" || len(images) != 1 || images[0].Alt != "Nothing at all" || !strings.Contains(string(images[0].Image), "blob1") {
+		t.Fatalf("Wrong images %v", record.Record.Embed)
+	}
+	if strings.Join(uploads, ",") != "image/png" {
+		t.Fatalf("Image not uploaded %v", uploads)
+	}
+
+	// Too big, so the thumbnail goes instead, with the image's alt text
+	previousLimit := blueskyBlobLimit
+	defer func() { blueskyBlobLimit = previousLimit }()
+	blueskyBlobLimit = 10
+	uploads = []string{}
+	if _, err = target.Post(target.Format(&toot)); err != nil {
+		t.Fatalf("Failed to post %v", err)
+	}
+	images = record.Record.Embed.Images
+	if strings.Join(uploads, ",") != "image/jpeg" || len(images) != 1 || images[0].Alt != "Nothing at all" {
+		t.Fatalf("Wrong thumbnail for a big image %v %v", uploads, record.Record.Embed)
+	}
+
+	// The card still goes if its picture doesn't
+	uploadsFail := mocks.GetDoFunc
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, "uploadBlob") {
+			return &http.Response{StatusCode: 500, Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+		}
+		return uploadsFail(req)
+	}
+	record.Record.Embed = blueskyEmbed{}
+	if _, err = target.Post(target.Format(&article)); err != nil {
+		t.Fatalf("Card dropped with its picture %v", err)
+	}
+	external = record.Record.Embed.External
+	if external == nil || external.URI != article.Link || len(external.Thumb) != 0 {
+		t.Fatalf("Wrong card without a picture %v", record.Record.Embed)
+	}
+}
+
+func TestBlueskySessionReuse(t *testing.T) {
+	keepConfig(t)
+	previousClient := Client
+	t.Cleanup(func() { Client = previousClient })
+	ConfigData.TempDir = t.TempDir()
+	jwt := func(expires time.Time) string {
+		return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expires.Unix()))) + ".c2lnbmF0dXJl"
+	}
+	expired, fresh := jwt(time.Now().Add(-time.Hour)), jwt(time.Now().Add(time.Hour))
+	calls := []string{}
+	status := 200
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		calls = append(calls, method+" "+req.Header.Get("Authorization"))
+		if method == "com.atproto.server.createSession" {
+			return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{"accessJwt":"` + expired + `","refreshJwt":"` + fresh + `"}`))}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"accessJwt":"` + fresh + `","refreshJwt":"` + fresh + `"}`))}, nil
+	}
+	target := &blueskySyndicator{config: Bluesky{URL: "https://bsky.example.com/", Userid: "professor", Password: "secret"}}
+
+	for i := 0; i < 3; i++ {
+		if token, err := target.login(); err != nil || token == "" {
+			t.Fatalf("Login %d failed %s %v", i, token, err)
+		}
+	}
+	// The first session's access token has expired, so it's refreshed, then reused
+	expected := "com.atproto.server.createSession |com.atproto.server.refreshSession Bearer " + fresh
+	if strings.Join(calls, "|") != expected {
+		t.Fatalf("Wrong calls\n%v", calls)
+	}
+
+	other := &blueskySyndicator{config: Bluesky{URL: "https://bsky.example.com/", Userid: "someone"}}
+	status = 401
+	if _, err := other.login(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Used another account's session %v", err)
+	}
+}
+
+func TestBlueskyExpiredSessionRetried(t *testing.T) {
+	keepConfig(t)
+	previousClient := Client
+	t.Cleanup(func() { Client = previousClient })
+	ConfigData.TempDir = t.TempDir()
+	claims := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())))
+	live, revoked := claims+".c2lnbmF0dXJl", claims+".cmV2b2tlZA"
+	target := &blueskySyndicator{config: Bluesky{URL: "https://bsky.example.com/", Userid: "professor", Password: "secret"}}
+	// Saved before the server revoked it, so it looks live
+	target.saveSession(blueskySession{URL: target.config.URL, Userid: "professor", AccessJWT: revoked})
+	calls := []string{}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		calls = append(calls, method)
+		switch {
+		case method == "com.atproto.server.createSession":
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"accessJwt":"` + live + `"}`))}, nil
+		case req.Header.Get("Authorization") != "Bearer "+live:
+			return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`{"error":"ExpiredToken"}`))}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"uri":"at://did:plc:me/app.bsky.feed.post/abc"}`))}, nil
+	}
+
+	link, err := target.Post(SyndicationMessage{Text: "Hi", CreatedAt: time.Now()})
+	if err != nil || link != "https://bsky.app/profile/vonexplaino.com/post/abc" {
+		t.Fatalf("Not posted after logging in again %s %v", link, err)
+	}
+	if strings.Join(calls, "|") != "com.atproto.repo.createRecord|com.atproto.server.createSession|com.atproto.repo.createRecord" {
+		t.Fatalf("Wrong calls %v", calls)
+	}
+	if saved, _ := target.loadSession(); saved.AccessJWT != live {
+		t.Fatalf("New session not saved %v", saved)
+	}
+}
@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PlannedSyndication struct {
+	File   string `json:"file"`
+	Target string `json:"target"`
+	Link   string `json:"link"`
+}
+
+// UpdatePlan is everything an update would change, worked out without
+// pulling from git, writing to the BaseDir or crossposting
+type UpdatePlan struct {
+	Mode          string               `json:"mode"`
+	Changes       GitDiffs             `json:"changes"`
+	Tags          []string             `json:"tags"`
+	FilesToDelete []string             `json:"filesToDelete"`
+	Pages         []string             `json:"pages"`
+	Drafts        []string             `json:"drafts"`
+	Scheduled     []string             `json:"scheduled"`
+	Retired       []string             `json:"retired"`
+	Media         []string             `json:"media"`
+	TagPages      []string             `json:"tagPages"`
+	IndexPages    []string             `json:"indexPages"`
+	ListPages     []string             `json:"listPages"`
+	Feeds         []string             `json:"feeds"`
+	Moved         []string             `json:"moved"`
+	Redirects     []string             `json:"redirects"`
+	Syndication   []PlannedSyndication `json:"syndication"`
+	Errors        []string             `json:"errors"`
+}
+
+func planUpdate() (UpdatePlan, error) {
+	var changes GitDiffs
+	var err error
+	var readSource func(filename string) (string, error)
+	plan := UpdatePlan{
+		Tags:          []string{},
+		FilesToDelete: []string{},
+		Pages:         []string{},
+		Drafts:        []string{},
+		Scheduled:     []string{},
+		Retired:       []string{},
+		Media:         []string{},
+		TagPages:      []string{},
+		IndexPages:    []string{},
+		ListPages:     []string{},
+		Feeds:         []string{},
+		Moved:         []string{},
+		Redirects:     []string{},
+		Syndication:   []PlannedSyndication{},
+		Errors:        []string{},
+	}
+	postsById := map[string]Item{}
+	targets := syndicators()
+	// The last build, to redirect any posts that have moved since
+	previous, _ := loadManifest(manifestDir())
+
+	readFile := func(filename string) (string, error) {
+		content, err := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, filename))
+		return string(content), err
+	}
+
+	if FullRegenerate {
+		plan.Mode = "full"
+		siteManifest = newManifest()
+		changes, err = PopulateAllGitFiles(ConfigData.RepositoryDir)
+		if err != nil {
+			return plan, fmt.Errorf("failed to get files in the directory %s [%s]", ConfigData.RepositoryDir, err)
+		}
+		readSource = readFile
+	} else if HashRegenerate {
+		plan.Mode = "hash"
+		loadSiteManifest()
+		postsById = siteManifest.postsById()
+		changes, _, err = hashChanges(templateDir())
+		if err != nil {
+			return plan, fmt.Errorf("failed to hash the files %v", err)
+		}
+		changes = addExpired(changes)
+		readSource = readFile
+	} else {
+		plan.Mode = "changed"
+		allPosts, err := ReadRSS(filepath.Join(ConfigData.BaseDir, "all-rss.xml"))
+		if err != nil {
+			return plan, fmt.Errorf("failed to read the RSS file %v", err)
+		}
+		postsById = changedPostsById(allPosts)
+		changes = addExpired(GitRunDiff())
+		// Read what the files will be after the pull, without pulling
+		readSource = func(filename string) (string, error) {
+			return GitShow("FETCH_HEAD", filename)
+		}
+	}
+	plan.Changes = changes
+
+	buildReport = newBuildReport()
+	tags, filesToDelete, postsById := getAllChangedTagsAndDeletedFiles(changes, postsById)
+	for _, e := range buildReport.Errors {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("%s: %s", e.File, e.Error))
+	}
+
+	for _, group := range [][]string{
+		changes.Added,
+		changes.CopyEdit,
+		changes.Modified,
+		changes.RenameEdit,
+		changes.Unmerged} {
+		for _, filename := range group {
+			filename = strings.ReplaceAll(filename, `\`, `/`)
+			if filepath.Ext(filename) == ".md" {
+				content, err := readSource(filename)
+				if err != nil {
+					plan.Errors = append(plan.Errors, fmt.Sprintf("%s: %v", filename, err))
+					continue
+				}
+				_, frontmatter, err := parseString(content, filepath.Join(ConfigData.RepositoryDir, filename))
+				if err != nil {
+					plan.Errors = append(plan.Errors, fmt.Sprintf("%s: %v", filename, err))
+					continue
+				}
+				if isUnpublished(frontmatter) {
+					if isScheduled(frontmatter) {
+						plan.Scheduled = append(plan.Scheduled, fmt.Sprintf("%s (%s)", filename, frontmatter.publishDate().Format(time.RFC3339)))
+					} else {
+						plan.Drafts = append(plan.Drafts, filename)
+					}
+					delete(postsById, frontmatter.Link)
+					if previous, ok := siteManifest.remove(filename); ok {
+						filesToDelete[previous.Output] = struct{}{}
+						touchTags(tags, previous.Tags)
+					}
+					continue
+				}
+				plan.Pages = append(plan.Pages, path.Join(baseDirectoryForPosts, frontmatter.RelativeLink))
+				if isRetired(frontmatter) {
+					plan.Retired = append(plan.Retired, filename)
+				}
+				for _, tag := range frontmatter.Tags {
+					tag = strings.ToLower(tag)
+					if isRetired(frontmatter) {
+						touchTags(tags, []string{tag})
+					} else {
+						tags[tag] = append(tags[tag], frontmatter)
+					}
+				}
+				// Only in memory, so the tag page counts include the new version
+				if previous, ok := siteManifest.record(filename, frontmatter, []byte(content)); ok {
+					touchTags(tags, previous.Tags)
+					if previous.Output != siteManifest.Entries[manifestKey(filename)].Output {
+						filesToDelete[previous.Output] = struct{}{}
+						delete(postsById, previous.FrontMatter.Link)
+						siteManifest.addRedirect(previous.Output, previous.FrontMatter.Link, frontmatter.Link)
+					}
+				}
+				if isRetired(frontmatter) {
+					delete(postsById, frontmatter.Link)
+					continue
+				}
+				if isFeedPost(frontmatter) {
+					postsById[frontmatter.Link] = PostToItem(frontmatter)
+				}
+				for _, target := range targets {
+					if target.Wants(frontmatter) {
+						plan.Syndication = append(plan.Syndication, PlannedSyndication{File: filename, Target: strings.ToLower(target.Name()), Link: frontmatter.Link})
+					}
+				}
+			} else if strings.HasPrefix(strings.TrimPrefix(filename, "/"), "media") {
+				plan.Media = append(plan.Media, filename)
+			}
+		}
+	}
+
+	siteManifest.redirectMoved(previous)
+	for from, to := range siteManifest.Redirects {
+		if previous.Redirects[from] != to {
+			plan.Moved = append(plan.Moved, from+" -> "+to)
+		}
+	}
+	plan.Redirects = redirectFiles(siteManifest.redirects())
+
+	for filename := range filesToDelete {
+		plan.FilesToDelete = append(plan.FilesToDelete, filename)
+	}
+	for tag, frontMatters := range siteManifest.retag(tags) {
+		plan.Tags = append(plan.Tags, tag)
+		filename := "tag/" + textToSlug(tag)
+		plan.Feeds = append(plan.Feeds, filename+".xml", filename+".atom", filename+".json")
+		plan.Feeds = append(plan.Feeds, archivePageNames(filename+".xml", len(frontMatters), listFeedLimit)...)
+		plan.TagPages = append(plan.TagPages, listPageNames(filename, len(frontMatters))...)
+	}
+	plan.Feeds = append(plan.Feeds, "all-rss.xml", "rss.xml", "all-atom.xml", "atom.xml", "feed.json")
+	plan.Feeds = append(plan.Feeds, archivePageNames("rss.xml", len(postsById), latestFeedLimit)...)
+	// The lists by type of post and by date, from createTypeAndDatePages
+	types, years, months := siteManifest.listed()
+	if siteManifest.Partial {
+		types, years, months = nil, nil, nil
+	}
+	for postType, posts := range types {
+		filename := path.Join("type", textToSlug(postType))
+		plan.Feeds = append(plan.Feeds, filename+".xml", filename+".atom", filename+".json")
+		plan.Feeds = append(plan.Feeds, archivePageNames(filename+".xml", len(posts), listFeedLimit)...)
+		plan.ListPages = append(plan.ListPages, listPageNames(filename, len(posts))...)
+	}
+	for _, dates := range []map[string][]FrontMatter{years, months} {
+		for dir, posts := range dates {
+			filename := path.Join(dir, "index")
+			plan.Feeds = append(plan.Feeds, filename+".xml", filename+".atom", filename+".json")
+			plan.Feeds = append(plan.Feeds, archivePageNames(filename+".xml", len(posts), listFeedLimit)...)
+			plan.ListPages = append(plan.ListPages, listPageNames(filename, len(posts))...)
+			plan.ListPages = append(plan.ListPages, filename+".html")
+		}
+	}
+	posts := siteManifest.byLink()
+	for _, item := range postsById {
+		post, ok := posts[item.GUID]
+		if !ok {
+			post = ItemToPost(item)
+		}
+		if post.Type == "episode" {
+			plan.Feeds = append(plan.Feeds, podcastFilename)
+			break
+		}
+	}
+	plan.IndexPages = append(listPageNames("index", len(postsById)), "posts/page/welcome.html")
+	// The OPML of the feeds, and the blogroll, from writeOPMLFiles
+	if !siteManifest.Partial {
+		plan.Feeds = append(plan.Feeds, feedsOPMLFilename)
+	}
+	blogroll, err := readBlogroll()
+	if err != nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("%s: %v", blogrollFilename, err))
+	}
+	if len(blogroll) > 0 {
+		plan.Feeds = append(plan.Feeds, blogrollOPMLFilename)
+		plan.IndexPages = append(plan.IndexPages, blogrollHTMLFilename)
+	}
+	for _, tag := range ConfigData.TagSnippets {
+		plan.IndexPages = append(plan.IndexPages, "tag-snippet-"+tag+".html")
+	}
+	for _, list := range [][]string{plan.Tags, plan.FilesToDelete, plan.TagPages, plan.ListPages, plan.Feeds, plan.Moved} {
+		sort.Strings(list)
+	}
+	return plan, nil
+}
+
+// listPageNames returns the pages WriteListHTML writes for a list of count posts
+func listPageNames(filenamePrefix string, count int) []string {
+	names := []string{}
+	if count == 0 {
+		return names
+	}
+	perPage := max(ConfigData.PerPage, 1)
+	pageCount := int(math.Ceil(float64(count) / float64(perPage)))
+	for page := 1; page <= pageCount; page++ {
+		names = append(names, fmt.Sprintf("%s-%d.html", filenamePrefix, page))
+	}
+	return names
+}
+
+// archivePageNames returns the archive pages WriteRSSArchive writes for a feed
+// of count items
+func archivePageNames(filename string, count int, limit int) []string {
+	names := []string{}
+	if limit <= 0 {
+		return names
+	}
+	for page := 1; page <= count/limit; page++ {
+		names = append(names, archiveFilename(filename, page))
+	}
+	return names
+}
+
+func printPlan(plan UpdatePlan, asJSON bool) {
+	if asJSON {
+		out, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Print(plan.Text())
+}
+
+// Text is the plan as a human readable list
+func (plan UpdatePlan) Text() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "Dry run (%s), nothing has been written\n", plan.Mode)
+	fmt.Fprintf(&out, "Changes: A: %d, M: %d, D: %d\n",
+		len(plan.Changes.Added),
+		len(plan.Changes.Modified)+len(plan.Changes.CopyEdit)+len(plan.Changes.RenameEdit)+len(plan.Changes.Unmerged),
+		len(plan.Changes.Deleted))
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Delete", plan.FilesToDelete},
+		{"Write pages", plan.Pages},
+		{"Skip drafts", plan.Drafts},
+		{"Schedule", plan.Scheduled},
+		{"Retire", plan.Retired},
+		{"Copy media", plan.Media},
+		{"Tags", plan.Tags},
+		{"Write tag pages", plan.TagPages},
+		{"Write index pages", plan.IndexPages},
+		{"Write list pages", plan.ListPages},
+		{"Write feeds", plan.Feeds},
+		{"Moved", plan.Moved},
+		{"Write redirects", plan.Redirects},
+		{"Errors", plan.Errors},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "%s (%d):\n", section.title, len(section.items))
+		for _, item := range section.items {
+			fmt.Fprintf(&out, "  %s\n", item)
+		}
+	}
+	if len(plan.Syndication) > 0 {
+		fmt.Fprintf(&out, "Crosspost (%d):\n", len(plan.Syndication))
+		for _, s := range plan.Syndication {
+			fmt.Fprintf(&out, "  %s: %s (%s)\n", s.Target, s.File, s.Link)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestListPageNames(t *testing.T) {
+	keepConfig(t)
+	ConfigData.PerPage = 2
+	names := listPageNames("tag/code", 5)
+	if len(names) != 3 || names[0] != "tag/code-1.html" || names[2] != "tag/code-3.html" {
+		t.Fatalf("Wrong page names %v", names)
+	}
+	if len(listPageNames("index", 0)) != 0 {
+		t.Fatalf("Made pages for nothing")
+	}
+}
+
+func TestArchivePageNames(t *testing.T) {
+	names := archivePageNames("tag/code.xml", 45, 20)
+	if strings.Join(names, ",") != "archive/tag/code-1.xml,archive/tag/code-2.xml" {
+		t.Fatalf("Wrong archive pages %v", names)
+	}
+	if len(archivePageNames("rss.xml", 9, 10)) != 0 {
+		t.Fatalf("Archived a feed that isn't full")
+	}
+}
+
+func TestPlanUpdateFull(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md": "---\nTitle: One\nTags: [Code, steampunk]\nCreated: 2024-05-01T10:00:00+1000\nSyndication:\n  Mastodon: XPOST\n  Bluesky: XPOST\n---\nBody",
+		"posts/article/two.md": "---\nTitle: Two\nStatus: draft\nCreated: 2024-05-02T10:00:00+1000\n---\nBody",
+		"media/image.png":      "not really",
+		"blogroll.yaml":        "- title: Friend\n  feed: https://friend.example.com/rss.xml\n  site: https://friend.example.com/\n",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.PerPage = 10
+	ConfigData.TagSnippets = []string{}
+	// Only Mastodon is set up, so there's no Bluesky crosspost
+	ConfigData.Syndication = Syndics{Mastodon: Mastodon{URL: "https://mstdn.example.com/api/", Token: "token"}}
+	FullRegenerate = true
+	defer func() { FullRegenerate = false }()
+
+	plan, err := planUpdate()
+	if err != nil {
+		t.Fatalf("Failed to plan %v", err)
+	}
+	if len(plan.Pages) != 1 || plan.Pages[0] != "posts/article/2024/05/one.html" {
+		t.Fatalf("Wrong pages %v", plan.Pages)
+	}
+	if len(plan.Drafts) != 1 {
+		t.Fatalf("Wrong drafts %v", plan.Drafts)
+	}
+	if len(plan.Media) != 1 {
+		t.Fatalf("Wrong media %v", plan.Media)
+	}
+	if strings.Join(plan.Tags, ",") != "code,steampunk" {
+		t.Fatalf("Wrong tags %v", plan.Tags)
+	}
+	if strings.Join(plan.TagPages, ",") != "tag/code-1.html,tag/steampunk-1.html" {
+		t.Fatalf("Wrong tag pages %v", plan.TagPages)
+	}
+	if len(plan.IndexPages) != 3 || plan.IndexPages[0] != "index-1.html" || plan.IndexPages[2] != "blogroll.html" {
+		t.Fatalf("Wrong index pages %v", plan.IndexPages)
+	}
+	for _, feed := range []string{"all-atom.xml", "atom.xml", "tag/code.atom", "feed.json", "tag/code.json", "feeds.opml", "blogroll.opml"} {
+		if !contains(plan.Feeds, feed) {
+			t.Fatalf("Missing %s from the feeds %v", feed, plan.Feeds)
+		}
+	}
+	if !contains(plan.Feeds, "type/article.atom") {
+		t.Fatalf("Missing the type feeds %v", plan.Feeds)
+	}
+	if strings.Join(plan.ListPages, ",") != "2024/05/index-1.html,2024/05/index.html,2024/index-1.html,2024/index.html,type/article-1.html" {
+		t.Fatalf("Wrong list pages %v", plan.ListPages)
+	}
+	if contains(plan.Feeds, podcastFilename) {
+		t.Fatalf("Podcast without any episodes %v", plan.Feeds)
+	}
+	if len(plan.Syndication) != 1 || plan.Syndication[0].Target != "mastodon" {
+		t.Fatalf("Wrong syndication %v", plan.Syndication)
+	}
+	files, _ := os.ReadDir(ConfigData.BaseDir)
+	if len(files) != 0 {
+		t.Fatalf("Dry run wrote to the base dir %v", files)
+	}
+
+	out, err := json.Marshal(plan)
+	if err != nil || !strings.Contains(string(out), `"pages":["posts/article/2024/05/one.html"]`) {
+		t.Fatalf("Bad JSON plan %s %v", out, err)
+	}
+	if !strings.Contains(plan.Text(), "mastodon: /posts/article/one.md") {
+		t.Fatalf("Bad text plan %s", plan.Text())
+	}
+}
+
+func TestPlanUpdateRedirects(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousManifest := siteManifest
+	t.Cleanup(func() { siteManifest = previousManifest })
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md": "---\nTitle: One\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.TempDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Redirects = []string{"stub", "htaccess"}
+	previous := newManifest()
+	previous.Entries["posts/article/one.md"] = ManifestEntry{
+		Source:      "posts/article/one.md",
+		Output:      "posts/article/2024/05/old.html",
+		FrontMatter: FrontMatter{Title: "One", Link: "https://vonexplaino.com/blog/posts/article/2024/05/old.html"},
+	}
+	previous.write(manifestDir())
+	FullRegenerate = true
+	defer func() { FullRegenerate = false }()
+
+	plan, err := planUpdate()
+	if err != nil {
+		t.Fatalf("Failed to plan %v", err)
+	}
+	if strings.Join(plan.Moved, ",") != "posts/article/2024/05/old.html -> https://vonexplaino.com/blog/posts/article/2024/05/one.html" {
+		t.Fatalf("Wrong moved posts %v", plan.Moved)
+	}
+	if strings.Join(plan.Redirects, ",") != ".htaccess,posts/article/2024/05/old.html" {
+		t.Fatalf("Wrong redirects %v", plan.Redirects)
+	}
+	if !strings.Contains(plan.Text(), "Write redirects (2):") {
+		t.Fatalf("Redirects not in the text plan %s", plan.Text())
+	}
+}
+
+func TestPlanUpdatePodcast(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/episode/pilot.md": "---\nTitle: Pilot\nType: episode\nCreated: 2024-05-03T10:00:00+1000\nEpisode:\n  Audio: /blog/media/pilot.mp3\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	FullRegenerate = true
+	defer func() { FullRegenerate = false }()
+
+	plan, err := planUpdate()
+	if err != nil || len(plan.Errors) != 0 {
+		t.Fatalf("Failed to plan %v %v", err, plan.Errors)
+	}
+	if !contains(plan.Feeds, podcastFilename) {
+		t.Fatalf("Missing the podcast from the feeds %v", plan.Feeds)
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type JSONFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type JSONFeedHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// JSONFeedIndieweb is the _indieweb extension, for posts that are about
+// another page
+type JSONFeedIndieweb struct {
+	Type       string `json:"type"`
+	InReplyTo  string `json:"in-reply-to,omitempty"`
+	BookmarkOf string `json:"bookmark-of,omitempty"`
+	FavoriteOf string `json:"favorite-of,omitempty"`
+	RepostOf   string `json:"repost-of,omitempty"`
+	LikeOf     string `json:"like-of,omitempty"`
+}
+
+type JSONFeedItem struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url"`
+	Title         string            `json:"title,omitempty"`
+	ContentHTML   string            `json:"content_html,omitempty"`
+	ContentText   string            `json:"content_text,omitempty"`
+	Summary       string            `json:"summary,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	DatePublished string            `json:"date_published"`
+	DateModified  string            `json:"date_modified,omitempty"`
+	Authors       []JSONFeedAuthor  `json:"authors,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Indieweb      *JSONFeedIndieweb `json:"_indieweb,omitempty"`
+	PubDateAsDate time.Time         `json:"-"`
+}
+
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Hubs        []JSONFeedHub    `json:"hubs,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+// WriteJSONFeed writes the feed as a JSON Feed into the BaseDir, newest
+// items first and no more than limit of them if limit isn't -1
+func WriteJSONFeed(feed JSONFeed, filename string, limit int) error {
+	feed.Version = jsonFeedVersion
+	feed.FeedURL, _ = url.JoinPath(ConfigData.BaseURL, filename)
+	if feed.Title == "" {
+		feed.Title = ConfigData.Metadata.Title
+		feed.Description = ConfigData.Metadata.Description
+	}
+	feed.Language = ConfigData.Metadata.Language
+	author := webmasterPerson()
+	feed.Authors = []JSONFeedAuthor{{Name: author.Name, URL: author.URI}}
+	for _, hub := range hubLinks() {
+		feed.Hubs = append(feed.Hubs, JSONFeedHub{Type: "WebSub", URL: hub.Href})
+	}
+	sort.SliceStable(feed.Items, func(p, q int) bool {
+		return feed.Items[p].PubDateAsDate.After(feed.Items[q].PubDateAsDate)
+	})
+	if limit > -1 {
+		limit = min(limit, len(feed.Items))
+		feed.Items = feed.Items[0:limit]
+	}
+	byteValue, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFeed(filename, byteValue, true)
+}
+
+// PostsToJSONFeed is the JSON Feed of the posts, with the list page it goes with as the home page
+func PostsToJSONFeed(posts []FrontMatter, title string, description string, homePage string) JSONFeed {
+	feed := JSONFeed{
+		Title:       title,
+		Description: description,
+		HomePageURL: homePage,
+		Items:       make([]JSONFeedItem, 0, len(posts)),
+	}
+	for _, post := range posts {
+		feed.Items = append(feed.Items, PostToJSONFeedItem(post))
+	}
+	return feed
+}
+
+func PostToJSONFeedItem(frontmatter FrontMatter) JSONFeedItem {
+	item := JSONFeedItem{
+		ID:            frontmatter.Link,
+		URL:           frontmatter.Link,
+		Title:         frontmatter.Title,
+		ContentHTML:   frontmatter.Content,
+		Summary:       frontmatter.Synopsis,
+		DatePublished: frontmatter.CreatedDate.Format(time.RFC3339),
+		Tags:          frontmatter.Tags,
+		PubDateAsDate: frontmatter.CreatedDate,
+	}
+	if item.ContentHTML == "" {
+		// A post read back from the RSS file has no content, and an item needs one or the other
+		item.ContentText = frontmatter.Synopsis
+		if item.ContentText == "" {
+			item.ContentText = frontmatter.Title
+		}
+		if item.ContentText == "" {
+			item.ContentText = frontmatter.Link
+		}
+	}
+	if frontmatter.FeatureImage != "" {
+		item.Image = absoluteLink(frontmatter.FeatureImage)
+	}
+	if frontmatter.UpdatedDate.After(frontmatter.CreatedDate) {
+		item.DateModified = frontmatter.UpdatedDate.Format(time.RFC3339)
+	}
+	if frontmatter.Author != "" {
+		item.Authors = []JSONFeedAuthor{{Name: frontmatter.Author}}
+	}
+	indieweb := JSONFeedIndieweb{
+		InReplyTo:  frontmatter.InReplyTo,
+		BookmarkOf: frontmatter.BookmarkOf,
+		FavoriteOf: frontmatter.FavoriteOf,
+		RepostOf:   frontmatter.RepostOf,
+		LikeOf:     frontmatter.LikeOf,
+	}
+	for _, kind := range []struct{ name, link string }{
+		{"reply", indieweb.InReplyTo},
+		{"bookmark", indieweb.BookmarkOf},
+		{"favorite", indieweb.FavoriteOf},
+		{"repost", indieweb.RepostOf},
+		{"like", indieweb.LikeOf},
+	} {
+		if kind.link != "" {
+			indieweb.Type = kind.name
+			item.Indieweb = &indieweb
+			break
+		}
+	}
+	return item
+}
+
+// absoluteLink resolves a link on the site, like /blog/media/x.jpg, against the BaseURL
+func absoluteLink(link string) string {
+	base, err := url.Parse(ConfigData.BaseURL)
+	if err != nil {
+		return link
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONFeed(t *testing.T) {
+	keepConfig(t)
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Title = "Professor von Explaino"
+	ConfigData.Metadata.Language = "en-au"
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "tag"), 0755)
+	older, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	newer, _ := time.Parse(time.RFC3339, "2024-05-02T10:00:00+10:00")
+	edited, _ := time.Parse(time.RFC3339, "2024-06-01T10:00:00+10:00")
+	posts := []FrontMatter{
+		{Title: "Older", Link: "https://vonexplaino.com/blog/posts/article/2024/05/older.html", Tags: []string{"Code"}, CreatedDate: older, UpdatedDate: edited,
+			Synopsis: "Old one", Content: "<p>Old one</p>", FeatureImage: "/blog/media/2024/05/older.jpg"},
+		{Title: "", Link: "https://vonexplaino.com/blog/posts/indieweb/2024/05/reply.html", Tags: []string{"Code"}, CreatedDate: newer,
+			InReplyTo: "https://example.com/post", Content: "<p>Agreed</p>"},
+	}
+
+	err := WriteJSONFeed(PostsToJSONFeed(posts, "Tagged Code", "Code posts", "https://vonexplaino.com/blog/tag/code-1.html"), "tag/code.json", -1)
+	if err != nil {
+		t.Fatalf("Failed to write the feed %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "tag/code.json"))
+	var feed JSONFeed
+	if err = json.Unmarshal(content, &feed); err != nil {
+		t.Fatalf("Not valid JSON %v\n%s", err, content)
+	}
+	if feed.Version != jsonFeedVersion || feed.Title != "Tagged Code" || feed.FeedURL != "https://vonexplaino.com/blog/tag/code.json" || feed.Language != "en-au" {
+		t.Fatalf("Wrong feed %v", feed)
+	}
+	if len(feed.Items) != 2 || feed.Items[0].Indieweb == nil || feed.Items[0].Indieweb.Type != "reply" || feed.Items[0].Indieweb.InReplyTo != "https://example.com/post" {
+		t.Fatalf("Wrong reply item %v", feed.Items)
+	}
+	old := feed.Items[1]
+	if old.Image != "https://vonexplaino.com/blog/media/2024/05/older.jpg" || old.DateModified != edited.Format(time.RFC3339) ||
+		old.DatePublished != older.Format(time.RFC3339) || old.ContentHTML != "<p>Old one</p>" || old.Summary != "Old one" || old.Indieweb != nil {
+		t.Fatalf("Wrong item %v", old)
+	}
+}
+
+func TestJSONFeedItemWithoutContent(t *testing.T) {
+	item := PostToJSONFeedItem(FrontMatter{Title: "Older", Link: "https://vonexplaino.com/blog/posts/article/2024/05/older.html", Synopsis: "Old one"})
+	if item.ContentHTML != "" || item.ContentText != "Old one" {
+		t.Fatalf("No synopsis for the content %v", item)
+	}
+	item = PostToJSONFeedItem(FrontMatter{Link: "https://vonexplaino.com/blog/posts/indieweb/2024/05/like.html"})
+	if item.ContentText != "https://vonexplaino.com/blog/posts/indieweb/2024/05/like.html" {
+		t.Fatalf("Item has no content %v", item)
+	}
+}
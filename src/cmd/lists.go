@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Types that are pages of their own, rather than posts to list
+var unlistedTypes = []string{"page", "resume"}
+
+// listed is the live posts for the type and date lists, by type, by year
+// (2024) and by month (2024/05)
+func (m *Manifest) listed() (map[string][]FrontMatter, map[string][]FrontMatter, map[string][]FrontMatter) {
+	types := map[string][]FrontMatter{}
+	years := map[string][]FrontMatter{}
+	months := map[string][]FrontMatter{}
+	for _, entry := range m.Entries {
+		post := entry.FrontMatter
+		if isRetired(post) || contains(unlistedTypes, post.Type) || post.CreatedDate.IsZero() {
+			continue
+		}
+		types[post.Type] = append(types[post.Type], post)
+		years[post.CreatedDate.Format("2006")] = append(years[post.CreatedDate.Format("2006")], post)
+		months[post.CreatedDate.Format("2006/01")] = append(months[post.CreatedDate.Format("2006/01")], post)
+	}
+	return types, years, months
+}
+
+// createTypeAndDatePages writes the list pages and feeds for each type of
+// post, and for each year and month
+func createTypeAndDatePages() {
+	if siteManifest.Partial {
+		PrintIfNotSilent("No full build manifest, leaving the type and date lists until a full regenerate\n")
+		return
+	}
+	types, years, months := siteManifest.listed()
+	for postType, posts := range types {
+		filename := path.Join("type", textToSlug(postType))
+		os.MkdirAll(filepath.Join(ConfigData.BaseDir, "type"), 0755)
+		writeListFeeds("type", FeedVars{Type: postType, Slug: textToSlug(postType)}, filename, posts, listFeedLimit)
+		buildReport.add(filename, "lists", WriteListHTML(posts, filename, "Type: "+postType))
+		// Fewer posts than before, so drop the pages past the end
+		removeNumberedFiles(filename, ".html", listPageCount(len(posts)))
+	}
+	for year, posts := range years {
+		writeDateList(year, posts, year)
+	}
+	for month, posts := range months {
+		writeDateList(month, posts, posts[0].CreatedDate.Format("January 2006"))
+	}
+}
+
+// listPageCount is how many list pages it takes for count posts
+func listPageCount(count int) int {
+	return int(math.Ceil(float64(count) / float64(max(ConfigData.PerPage, 1))))
+}
+
+// writeListFeeds writes the RSS, Atom and JSON feeds of a list of posts
+func writeListFeeds(kind string, vars FeedVars, filename string, posts []FrontMatter, limit int) {
+	channel, err := feedChannel(kind, vars)
+	buildReport.add(filename+".xml", "feed", err)
+	rss := RSS{Channel: channel}
+	for _, post := range posts {
+		rss.Channel.Items = append(rss.Channel.Items, PostToItem(post))
+	}
+	buildReport.add(filename+".xml", "feed", WriteRSSArchive(rss, filename+".xml", limit))
+	listLink, _ := url.JoinPath(ConfigData.BaseURL, filename+"-1.html")
+	atom := PostsToAtom(posts, channel.Title, channel.Description, listLink)
+	buildReport.add(filename+".atom", "feed", WriteAtom(atom, filename+".atom", limit))
+	jsonFeed := PostsToJSONFeed(posts, channel.Title, channel.Description, listLink)
+	buildReport.add(filename+".json", "feed", WriteJSONFeed(jsonFeed, filename+".json", limit))
+}
+
+// writeDateList writes the list pages and feeds for a year or month into its
+// directory, with the first page as the index so /2024/05/ works
+func writeDateList(dir string, posts []FrontMatter, date string) {
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, dir), 0755)
+	filename := path.Join(dir, "index")
+	writeListFeeds("date", FeedVars{Date: date, Slug: dir}, filename, posts, listFeedLimit)
+	err := WriteListHTML(posts, filename, "Archive: "+date)
+	removeNumberedFiles(filename, ".html", listPageCount(len(posts)))
+	if err == nil {
+		var content []byte
+		content, err = os.ReadFile(filepath.Join(ConfigData.BaseDir, filename+"-1.html"))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(ConfigData.BaseDir, dir, "index.html"), content, 0777)
+		}
+	}
+	buildReport.add(filename, "lists", err)
+}
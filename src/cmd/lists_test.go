@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateTypeAndDatePages(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest := buildReport, siteManifest
+	t.Cleanup(func() { buildReport, siteManifest = previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md":   "---\nTitle: One\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+		"posts/article/two.md":   "---\nTitle: Two\nTags: [Code]\nCreated: 2024-06-01T10:00:00+1000\n---\nBody",
+		"posts/toot/three.md":    "---\nTitle: Three\nType: toot\nCreated: 2024-05-02T10:00:00+1000\n---\nBody",
+		"posts/article/gone.md":  "---\nTitle: Gone\nStatus: retired\nCreated: 2024-05-03T10:00:00+1000\n---\nBody",
+		"posts/page/about-me.md": "---\nTitle: About\nType: page\nCreated: 2024-05-04T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.PerPage = 10
+	ConfigData.Metadata.Title = "Professor"
+	// Pages from when there were more posts
+	for _, stale := range []string{"type/article-2.html", "2024/05/index-2.html"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(ConfigData.BaseDir, stale)), 0755)
+		os.WriteFile(filepath.Join(ConfigData.BaseDir, stale), []byte("old"), 0666)
+	}
+	processFileUpdates(GitDiffs{Added: []string{"posts/article/one.md", "posts/article/two.md", "posts/toot/three.md", "posts/article/gone.md", "posts/page/about-me.md"}},
+		map[string][]FrontMatter{}, map[string]Item{})
+
+	createTypeAndDatePages()
+	if buildReport.failed() {
+		t.Fatalf("Lists failed %s", buildReport.Summary())
+	}
+	for page, expected := range map[string][]string{
+		"type/article-1.html":  {"One", "Two"},
+		"type/toot-1.html":     {"Three"},
+		"2024/index-1.html":    {"One", "Two", "Three"},
+		"2024/05/index-1.html": {"One", "Three"},
+		"2024/05/index.html":   {"One", "Three"},
+		"2024/06/index.html":   {"Two"},
+		"type/article.xml":     {"One", "Two", "<title>Professor: article</title>", "type/article.xml"},
+		"type/article.atom":    {"One", "Two"},
+		"type/toot.json":       {"Three"},
+		"2024/05/index.xml":    {"One", "Three", "<title>Professor: May 2024</title>"},
+		"2024/index.atom":      {"One", "Two", "Three"},
+		"2024/06/index.json":   {"Two"},
+	} {
+		content, err := os.ReadFile(filepath.Join(ConfigData.BaseDir, page))
+		if err != nil {
+			t.Fatalf("No %s %v", page, err)
+		}
+		for _, text := range expected {
+			if !strings.Contains(string(content), text) {
+				t.Fatalf("%s doesn't have %s\n%s", page, text, content)
+			}
+		}
+		if strings.Contains(string(content), "Gone") || strings.Contains(string(content), "About") {
+			t.Fatalf("%s lists a retired post or a page\n%s", page, content)
+		}
+	}
+	for _, gone := range []string{"type/page-1.html", "type/article-2.html", "2024/05/index-2.html"} {
+		if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, gone)); err == nil {
+			t.Fatalf("%s shouldn't be there", gone)
+		}
+	}
+}
+
+func TestTypeAndDatePagesWithoutManifest(t *testing.T) {
+	keepConfig(t)
+	previousManifest := siteManifest
+	t.Cleanup(func() { siteManifest = previousManifest })
+	siteManifest = newManifest()
+	siteManifest.Partial = true
+	post := FrontMatter{Title: "One", Type: "article", CreatedDate: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	siteManifest.Entries["posts/article/one.md"] = ManifestEntry{FrontMatter: post}
+	ConfigData.BaseDir = t.TempDir()
+
+	createTypeAndDatePages()
+	// The lists would only have the posts the manifest knows about
+	if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, "type/article-1.html")); err == nil {
+		t.Fatalf("Lists written from a partial manifest")
+	}
+}
@@ -24,11 +24,13 @@ func setEnvironments() {
 	}
 }
 
-func GitPull() {
+func GitPull() error {
 	l, e := runGitCommand(gitCommand, []string{"pull"})
 	if e != nil {
 		fmt.Printf("Failed %s\n%s\n", l, e)
+		return fmt.Errorf("git pull failed %s [%v]", l, e)
 	}
+	return nil
 }
 
 func GitFetch() {
@@ -43,6 +45,10 @@ func GitCommit(message string) {
 	runGitCommand(gitCommand, []string{"commit", "--message", fmt.Sprintf(`"%s"`, message)})
 }
 
+func GitShow(ref string, filename string) (string, error) {
+	return runGitCommand(gitCommand, []string{"show", ref + ":" + filename})
+}
+
 func GitPush() {
 	runGitCommand(gitCommand, []string{"push"})
 }
@@ -54,16 +60,19 @@ type GitDiffs struct {
 	Added      []string
 	Deleted    []string
 	Unmerged   []string
+	// The old name of each renamed or copied file, by its new name
+	RenamedFrom map[string]string
 }
 
 func ProcessGitDiffs(resultsStr string) GitDiffs {
 	returnDiffs := GitDiffs{
-		Modified:   make([]string, 0),
-		CopyEdit:   make([]string, 0),
-		RenameEdit: make([]string, 0),
-		Added:      make([]string, 0),
-		Deleted:    make([]string, 0),
-		Unmerged:   make([]string, 0),
+		Modified:    make([]string, 0),
+		CopyEdit:    make([]string, 0),
+		RenameEdit:  make([]string, 0),
+		Added:       make([]string, 0),
+		Deleted:     make([]string, 0),
+		Unmerged:    make([]string, 0),
+		RenamedFrom: map[string]string{},
 	}
 	for _, line := range strings.Split(resultsStr, "\n") {
 		line = strings.TrimSpace(line)
@@ -72,6 +81,11 @@ func ProcessGitDiffs(resultsStr string) GitDiffs {
 		}
 		index := line[0:1]
 		rest := strings.TrimSpace(line[2:])
+		// Renames and copies are "R100\told\tnew"
+		if fields := strings.Split(line, "\t"); len(fields) == 3 {
+			rest = fields[2]
+			returnDiffs.RenamedFrom[rest] = fields[1]
+		}
 		switch index {
 		case "M":
 			returnDiffs.Modified = append(returnDiffs.Modified, rest)
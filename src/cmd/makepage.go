@@ -121,7 +121,9 @@ func init() {
 	)
 }
 
-func convertGallery(mep []byte) []byte {
+// convertGallery turns a markdown gallery section into the radio button
+// gallery, with galleryIndex keeping the ids unique within the page
+func convertGallery(mep []byte, galleryIndex int) []byte {
 	re := regexp.MustCompile(`(<section [^>]*gallery[^>]*) markdown="1"([^>]*>)(?sm)(.*?)(</[^>]*>)`)
 	mep1 := re.FindAllStringSubmatch(string(mep), -1)
 	// Convert the image collection from Markdown to HTML
@@ -143,10 +145,10 @@ func convertGallery(mep []byte) []byte {
 					</figcaption>
 				</figure>
 		`,
-			gallery_index,
-			gallery_index,
+			galleryIndex,
+			galleryIndex,
 			i+1,
-			gallery_index,
+			galleryIndex,
 			i,
 			mep2[i][2],
 			mep2[i][1],
@@ -161,15 +163,14 @@ func convertGallery(mep []byte) []byte {
 				<label for="gallery-2020-4-%d-close">X</label>%s`,
 		mep1[0][1],
 		mep1[0][2],
-		gallery_index,
-		gallery_index,
+		galleryIndex,
+		galleryIndex,
 		stringOut,
-		gallery_index,
-		gallery_index,
-		gallery_index,
+		galleryIndex,
+		galleryIndex,
+		galleryIndex,
 		mep1[0][4],
 	))
-	gallery_index++
 	return temp
 }
 
@@ -193,7 +194,6 @@ func convertMarkdownHtml(mep []byte) []byte {
 	))
 }
 
-var gallery_index int
 var md goldmark.Markdown
 
 func filterTagLink(tag interface{}) string {
@@ -266,12 +266,18 @@ func parseFile(filename string) (string, FrontMatter, error) {
 
 var templ *template.Template
 
-func SetupTemplate() string {
+// templateDir is the configured template directory, or templates in the working directory
+func templateDir() string {
 	d, _ := os.Getwd()
 	tDir := filepath.Join(d, "templates")
 	if len(ConfigData.TemplateDir) > 0 {
 		tDir = ConfigData.TemplateDir
 	}
+	return tDir
+}
+
+func SetupTemplate() string {
+	tDir := templateDir()
 	if templ == nil {
 		templ = template.Must(
 			template.Must(
@@ -328,10 +334,15 @@ func parseString(body string, filename string) (string, FrontMatter, error) {
 	// Convert the Gallery tags
 	var buf2 bytes.Buffer
 	re := regexp.MustCompile(`<section [^>]*gallery[^>]* markdown="1"[^>]*>(?sm)(.*?)</section>`)
-	gallery_index = 0
+	// Counted per page, so pages can be converted at the same time
+	galleryIndex := 0
 	bodybyte := re.ReplaceAllFunc(
 		[]byte(body),
-		convertGallery,
+		func(mep []byte) []byte {
+			converted := convertGallery(mep, galleryIndex)
+			galleryIndex++
+			return converted
+		},
 	)
 	// Convert the markdown=1 tags
 	re = regexp.MustCompile(`<[^>]* markdown="1"[^>]*>(?sm)(.*?)</[^>]*>`)
@@ -342,6 +353,8 @@ func parseString(body string, filename string) (string, FrontMatter, error) {
 	// Now convert what's left to Markdown
 	md.Convert(bodybyte, &buf2)
 	html2 = buf2.String()
+	// Kept for the full content feeds
+	frontMatter.Content = html2
 
 	// Synopsis if empty
 	if len(frontMatter.Synopsis) == 0 {
@@ -356,8 +369,7 @@ func parseString(body string, filename string) (string, FrontMatter, error) {
 		strings.ToLower(frontMatter.Type),
 		toTemplateVariables(&frontMatter, html2),
 	); err != nil {
-		fmt.Printf("Couldn't write the file2\n")
-		log.Fatal(err)
+		return html2, frontMatter, fmt.Errorf("failed to apply the %s template [%v]", frontMatter.Type, err)
 	}
 
 	html2 = buf.String()
@@ -365,6 +377,18 @@ func parseString(body string, filename string) (string, FrontMatter, error) {
 	return html2, frontMatter, err
 }
 
+// Episode is a podcast episode, the audio and where it sits in the show
+type Episode struct {
+	Audio      string `yaml:"Audio"`
+	Duration   string `yaml:"Duration"`
+	Season     int    `yaml:"Season"`
+	Number     int    `yaml:"Number"`
+	Kind       string `yaml:"Type"`
+	Explicit   bool   `yaml:"Explicit"`
+	Transcript string `yaml:"Transcript"`
+	Chapters   string `yaml:"Chapters"`
+}
+
 type Event struct {
 	Start     string `yaml:"StartDate"`
 	End       string `yaml:"EndDate"`
@@ -474,17 +498,24 @@ type FrontMatter struct {
 	Tags             []string          `yaml:"Tags"`
 	Created          string            `yaml:"Created"`
 	Updated          string            `yaml:"Updated"`
+	PublishAt        string            `yaml:"PublishAt"`
+	Expires          string            `yaml:"Expires"`
 	Type             string            `yaml:"Type"`
 	Status           string            `yaml:"Status"`
 	Synopsis         string            `yaml:"Synopsis"`
 	Author           string            `yaml:"Author"`
 	FeatureImage     string            `yaml:"FeatureImage"`
 	AttachedMedia    []string          `yaml:"AttachedMedia"`
+	MediaAlt         map[string]string `yaml:"MediaAlt"`
+	ContentWarning   string            `yaml:"ContentWarning"`
 	SyndicationLinks SyndicationLinksS `yaml:"Syndication"`
 	Slug             string            `yaml:"Slug"`
 	Event            Event             `yaml:"Event"`
+	Episode          Episode           `yaml:"Episode"`
 	Resume           Resume            `yaml:"Resume"`
 	Link             string            `yaml:"Link"`
+	RedirectFrom     []string          `yaml:"RedirectFrom"`
+	Content          string            `yaml:"-"`
 	InReplyTo        string            `yaml:"in-reply-to"`
 	BookmarkOf       string            `yaml:"bookmark-of"`
 	FavoriteOf       string            `yaml:"favorite-of"`
@@ -494,6 +525,16 @@ type FrontMatter struct {
 	RelativeLink     string
 	CreatedDate      time.Time
 	UpdatedDate      time.Time
+	PublishAtDate    time.Time
+	ExpiresDate      time.Time
+}
+
+// publishDate is when the post goes live, PublishAt if it's set or else Created
+func (frontMatter FrontMatter) publishDate() time.Time {
+	if !frontMatter.PublishAtDate.IsZero() {
+		return frontMatter.PublishAtDate
+	}
+	return frontMatter.CreatedDate
 }
 
 func textToSlug(intext string) string {
@@ -534,6 +575,12 @@ func frontMatterDefaults(frontMatter *FrontMatter, filename string) {
 			frontMatter.Updated = updated.Format("2006-01-02T15:04:05-0700")
 		}
 	}
+	if frontMatter.PublishAt != "" {
+		frontMatter.PublishAtDate, _ = parseUnknownDateFormat(frontMatter.PublishAt)
+	}
+	if frontMatter.Expires != "" {
+		frontMatter.ExpiresDate, _ = parseUnknownDateFormat(frontMatter.Expires)
+	}
 
 	frontMatter.Slug = setEmptyStringDefault(frontMatter.Slug, textToSlug(frontMatter.Title))
 	ext := filepath.Ext(frontMatter.Slug)
@@ -541,6 +588,10 @@ func frontMatterDefaults(frontMatter *FrontMatter, filename string) {
 		frontMatter.Slug = frontMatter.Slug + ".html"
 	}
 	frontMatter.Status = setEmptyStringDefault(frontMatter.Status, "live")
+	if frontMatter.Status == "live" && !frontMatter.ExpiresDate.IsZero() && !frontMatter.ExpiresDate.After(DateOfExecution) {
+		// Past its use by date
+		frontMatter.Status = "retired"
+	}
 
 	if len(frontMatter.Tags) == 0 {
 		frontMatter.Tags = []string{}
@@ -586,7 +637,7 @@ func alphaOrderMap(existing map[string]string) []string {
 func frontMatterValidate(frontMatter *FrontMatter, filename string) []string {
 	var collectedErrors []string
 	// Valids
-	validTypes := []string{"article", "reply", "indieweb", "tweet", "toot", "resume", "event", "page", "review"}
+	validTypes := []string{"article", "reply", "indieweb", "tweet", "toot", "resume", "event", "page", "review", "episode"}
 	if filename != "" && frontMatter.Type == "" {
 		frontMatter.Type = defaultType(validTypes, filename)
 	} else {
@@ -598,6 +649,15 @@ func frontMatterValidate(frontMatter *FrontMatter, filename string) []string {
 	if !contains([]string{"draft", "live", "retired"}, frontMatter.Status) {
 		collectedErrors = append(collectedErrors, "bad status: "+frontMatter.Status)
 	}
+	if frontMatter.PublishAt != "" && frontMatter.PublishAtDate.IsZero() {
+		collectedErrors = append(collectedErrors, "bad publish at: "+frontMatter.PublishAt)
+	}
+	if frontMatter.Expires != "" && frontMatter.ExpiresDate.IsZero() {
+		collectedErrors = append(collectedErrors, "bad expires: "+frontMatter.Expires)
+	}
+	if frontMatter.Type == "episode" {
+		collectedErrors = append(collectedErrors, episodeValidate(frontMatter.Episode)...)
+	}
 	// Need to do this after Type is validated
 	if frontMatter.Link == "" {
 		if frontMatter.Type == "page" {
@@ -622,6 +682,23 @@ func frontMatterValidate(frontMatter *FrontMatter, filename string) []string {
 	frontMatter.Title = titleWithIcons(*frontMatter)
 	return collectedErrors
 }
+
+var episodeDuration = regexp.MustCompile(`^(\d+:)?([0-5]?\d:)?\d+$`)
+
+func episodeValidate(episode Episode) []string {
+	var collectedErrors []string
+	if episode.Audio == "" {
+		collectedErrors = append(collectedErrors, "episode has no audio")
+	}
+	if episode.Duration != "" && !episodeDuration.MatchString(episode.Duration) {
+		collectedErrors = append(collectedErrors, "bad episode duration: "+episode.Duration)
+	}
+	if !contains([]string{"", "full", "trailer", "bonus"}, episode.Kind) {
+		collectedErrors = append(collectedErrors, "bad episode type: "+episode.Kind)
+	}
+	return collectedErrors
+}
+
 func defaultType(validTypes []string, filename string) string {
 	re := regexp.MustCompile(`[/\\]posts[/\\](` + strings.Join(validTypes, "|") + `)[/\\]`)
 	indexes := re.FindStringSubmatch(filename)
@@ -654,10 +731,7 @@ func parseFrontMatter(inFrontMatter string, filename string) (FrontMatter, error
 	var frontMatter FrontMatter
 	err := yaml.Unmarshal([]byte(inFrontMatter), &frontMatter)
 	if err != nil {
-		fmt.Println("Failed to parse frontmatter")
-		fmt.Printf(" - %s\n", filename)
-		log.Fatal(err)
-		return frontMatter, err
+		return frontMatter, fmt.Errorf("failed to parse frontmatter in %s [%v]", filename, err)
 	}
 	frontMatterDefaults(&frontMatter, filename)
 	collectedErrors := frontMatterValidate(&frontMatter, filename)
@@ -816,7 +890,9 @@ func toTemplateVariables(frontMatter *FrontMatter, content string) map[string]in
 		"repostof":         frontMatter.RepostOf,
 		"resume":           frontMatter.Resume,
 		"item":             frontMatter.Item,
+		"episode":          frontMatter.Episode,
 		"syndicationlinks": frontMatter.SyndicationLinks,
+		"retired":          frontMatter.Status == "retired",
 	}
 }
 
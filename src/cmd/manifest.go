@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var manifestFilename = "build-manifest.json"
+
+// ManifestEntry is what the last build knew about a single source file
+type ManifestEntry struct {
+	Source      string      `json:"source"`
+	Output      string      `json:"output"`
+	Hash        string      `json:"hash"`
+	Tags        []string    `json:"tags"`
+	FrontMatter FrontMatter `json:"frontMatter"`
+}
+
+// Manifest records every published post from the last build, so an
+// incremental build knows the whole site without re-reading the repository.
+// Sources and Templates hold the hash of every file the build used.
+// Scheduled has the posts waiting to be published, and when.
+// Redirects sends the pages of moved posts to where they are now.
+// Feeds holds the hash of every feed, to tell which changed.
+// Partial is set when there was no manifest to load, so it lacks the posts
+// no build has touched since. It stays set until a full or hash regenerate.
+type Manifest struct {
+	Generated time.Time                `json:"generated"`
+	Entries   map[string]ManifestEntry `json:"entries"`
+	Sources   map[string]string        `json:"sources"`
+	Templates map[string]string        `json:"templates"`
+	Scheduled map[string]time.Time     `json:"scheduled"`
+	Redirects map[string]string        `json:"redirects"`
+	Feeds     map[string]string        `json:"feeds"`
+	Partial   bool                     `json:"partial,omitempty"`
+}
+
+var siteManifest = newManifest()
+
+func newManifest() Manifest {
+	return Manifest{
+		Entries:   map[string]ManifestEntry{},
+		Sources:   map[string]string{},
+		Templates: map[string]string{},
+		Scheduled: map[string]time.Time{},
+		Redirects: map[string]string{},
+		Feeds:     map[string]string{},
+	}
+}
+
+// manifestKey normalises a repository filename, as git or a directory walk gives it
+func manifestKey(filename string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(filename, `\`, `/`), "/")
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadManifest(dir string) (Manifest, error) {
+	manifest := newManifest()
+	content, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(content, &manifest)
+	if manifest.Entries == nil {
+		manifest.Entries = map[string]ManifestEntry{}
+	}
+	if manifest.Sources == nil {
+		manifest.Sources = map[string]string{}
+	}
+	if manifest.Templates == nil {
+		manifest.Templates = map[string]string{}
+	}
+	if manifest.Scheduled == nil {
+		manifest.Scheduled = map[string]time.Time{}
+	}
+	if manifest.Redirects == nil {
+		manifest.Redirects = map[string]string{}
+	}
+	if manifest.Feeds == nil {
+		manifest.Feeds = map[string]string{}
+	}
+	return manifest, err
+}
+
+// manifestDir is where the build manifest is kept. It's out of the BaseDir so
+// the scheduled posts and the content of every post aren't served.
+func manifestDir() string {
+	dir := ConfigData.TempDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return dir
+}
+
+func (m *Manifest) write(dir string) error {
+	m.Generated = time.Now()
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFilename), content, 0666)
+}
+
+// record stores a rendered post, returning the entry it replaced if there was one
+func (m *Manifest) record(filename string, frontmatter FrontMatter, content []byte) (ManifestEntry, bool) {
+	key := manifestKey(filename)
+	previous, ok := m.Entries[key]
+	tags := make([]string, 0, len(frontmatter.Tags))
+	for _, tag := range frontmatter.Tags {
+		tags = append(tags, strings.ToLower(tag))
+	}
+	delete(m.Scheduled, key)
+	m.Entries[key] = ManifestEntry{
+		Source:      key,
+		Output:      path.Join(baseDirectoryForPosts, frontmatter.RelativeLink),
+		Hash:        hashContent(content),
+		Tags:        tags,
+		FrontMatter: frontmatter,
+	}
+	return previous, ok
+}
+
+// recordSource stores the hash of a source file as it is in the repository
+func (m *Manifest) recordSource(filename string) {
+	content, err := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, filename))
+	if err == nil {
+		m.Sources[manifestKey(filename)] = hashContent(content)
+	}
+}
+
+// remove forgets a source file, returning what was known about it
+func (m *Manifest) remove(filename string) (ManifestEntry, bool) {
+	key := manifestKey(filename)
+	previous, ok := m.Entries[key]
+	delete(m.Entries, key)
+	delete(m.Sources, key)
+	delete(m.Scheduled, key)
+	return previous, ok
+}
+
+// rename moves what is known about a source file to its new name, so the
+// next record of it knows where its page was
+func (m *Manifest) rename(from, to string) {
+	fromKey, toKey := manifestKey(from), manifestKey(to)
+	if entry, ok := m.Entries[fromKey]; ok {
+		entry.Source = toKey
+		m.Entries[toKey] = entry
+	}
+	if publishAt, ok := m.Scheduled[fromKey]; ok {
+		m.Scheduled[toKey] = publishAt
+	}
+	m.remove(from)
+}
+
+// schedule notes a post to publish at a later time
+func (m *Manifest) schedule(filename string, publishAt time.Time) {
+	m.Scheduled[manifestKey(filename)] = publishAt
+}
+
+// expired is the published posts that have passed their Expires date, but
+// were built before then so haven't been retired yet
+func (m *Manifest) expired(now time.Time) []string {
+	expired := []string{}
+	for filename, entry := range m.Entries {
+		expires := entry.FrontMatter.ExpiresDate
+		if !expires.IsZero() && !expires.After(now) && !isRetired(entry.FrontMatter) {
+			expired = append(expired, filename)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// due is the scheduled posts that should be published by now, sorted
+func (m *Manifest) due(now time.Time) []string {
+	due := []string{}
+	for filename, publishAt := range m.Scheduled {
+		if !publishAt.After(now) {
+			due = append(due, filename)
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// tagged is every post in the manifest with the tag, except retired ones
+func (m *Manifest) tagged(tag string) []FrontMatter {
+	posts := []FrontMatter{}
+	for _, entry := range m.Entries {
+		if contains(entry.Tags, tag) && !isRetired(entry.FrontMatter) {
+			posts = append(posts, entry.FrontMatter)
+		}
+	}
+	return posts
+}
+
+// retag replaces the posts for each tag with the full list from the manifest,
+// dropping tags that no longer have any posts
+func (m *Manifest) retag(tags map[string][]FrontMatter) map[string][]FrontMatter {
+	retagged := map[string][]FrontMatter{}
+	for tag := range tags {
+		if posts := m.tagged(tag); len(posts) > 0 {
+			retagged[tag] = posts
+		}
+	}
+	return retagged
+}
+
+// byLink indexes the manifest posts by their Link, which is the RSS GUID
+func (m *Manifest) byLink() map[string]FrontMatter {
+	links := map[string]FrontMatter{}
+	for _, entry := range m.Entries {
+		links[entry.FrontMatter.Link] = entry.FrontMatter
+	}
+	return links
+}
+
+// postsById is the manifest as the items for the main feeds
+func (m *Manifest) postsById() map[string]Item {
+	postsById := map[string]Item{}
+	for _, entry := range m.Entries {
+		if isFeedPost(entry.FrontMatter) && !isRetired(entry.FrontMatter) {
+			postsById[entry.FrontMatter.Link] = PostToItem(entry.FrontMatter)
+		}
+	}
+	return postsById
+}
+
+// loadSiteManifest reads the manifest from the last build, or starts an
+// empty one if there isn't one yet
+func loadSiteManifest() bool {
+	var err error
+	siteManifest, err = loadManifest(manifestDir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			PrintIfNotSilent("Could not read the build manifest, starting a new one\n")
+		}
+		siteManifest = newManifest()
+		siteManifest.Partial = true
+		return false
+	}
+	return true
+}
+
+// changedPostsById gives every published post for a changed regenerate. A
+// partial manifest only has the posts builds have touched, so the rest come
+// from the all posts RSS file.
+func changedPostsById(allPosts RSS) map[string]Item {
+	postsById := map[string]Item{}
+	if !loadSiteManifest() || siteManifest.Partial {
+		PrintIfNotSilent("No full build manifest, lists will use the RSS file until a full regenerate\n")
+		for _, i := range allPosts.Channel.Items {
+			postsById[i.GUID] = i
+		}
+	}
+	// The manifest has its posts in full, the RSS file only has what fits in an item
+	for link, item := range siteManifest.postsById() {
+		postsById[link] = item
+	}
+	return postsById
+}
+
+// hashFiles hashes the files under each of the subdirectories of root
+func hashFiles(root string, subdirs []string) (map[string]string, error) {
+	hashes := map[string]string{}
+	for filename := range snapshotFiles(root, subdirs) {
+		content, err := os.ReadFile(filepath.Join(root, filename))
+		if err != nil {
+			return hashes, err
+		}
+		hashes[filename] = hashContent(content)
+	}
+	return hashes, nil
+}
+
+// hashChanges compares the repository and templates against the manifest
+// from the last build, listing what changed the way GitRunDiff would. Every
+// post is modified if any template changed. Also returns the template hashes
+// to store once the changes are built.
+func hashChanges(templateDir string) (GitDiffs, map[string]string, error) {
+	changes := GitDiffs{Added: []string{}, Modified: []string{}, Deleted: []string{}}
+	templates, err := hashFiles(templateDir, []string{""})
+	if err != nil {
+		return changes, templates, err
+	}
+	templatesChanged := len(templates) != len(siteManifest.Templates)
+	for filename, hash := range templates {
+		if siteManifest.Templates[filename] != hash {
+			templatesChanged = true
+		}
+	}
+	sources, err := hashFiles(ConfigData.RepositoryDir, []string{"posts", "media"})
+	if err != nil {
+		return changes, templates, err
+	}
+	for filename, hash := range sources {
+		previous, ok := siteManifest.Sources[filename]
+		if !ok {
+			changes.Added = append(changes.Added, filename)
+		} else if previous != hash || (templatesChanged && filepath.Ext(filename) == ".md") {
+			changes.Modified = append(changes.Modified, filename)
+		}
+	}
+	for filename := range siteManifest.Sources {
+		if _, ok := sources[filename]; ok {
+			continue
+		}
+		if _, published := siteManifest.Entries[filename]; published || filepath.Ext(filename) != ".md" {
+			changes.Deleted = append(changes.Deleted, filename)
+		} else {
+			// A draft or scheduled, so there's nothing on the site to remove
+			siteManifest.remove(filename)
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	return changes, templates, nil
+}
+
+// writeSiteManifest writes the build's manifest, reporting any failure, and
+// takes down the copy older builds left in the BaseDir
+func writeSiteManifest() {
+	if err := siteManifest.write(manifestDir()); err != nil {
+		fmt.Printf("Failed to write the build manifest %v\n", err)
+		buildReport.add(manifestFilename, "manifest", err)
+	}
+	os.Remove(filepath.Join(ConfigData.BaseDir, manifestFilename))
+}
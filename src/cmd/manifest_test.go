@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestRecordAndRemove(t *testing.T) {
+	m := newManifest()
+	one := FrontMatter{Title: "One", Tags: []string{"Code", "steampunk"}, Link: "https://example.com/posts/one.html", RelativeLink: "article/one.html"}
+	if _, ok := m.record(`\posts\article\one.md`, one, []byte("first")); ok {
+		t.Fatalf("Found a previous entry in an empty manifest")
+	}
+	entry := m.Entries["posts/article/one.md"]
+	if entry.Output != "posts/article/one.html" || entry.Tags[0] != "code" || entry.Hash == "" {
+		t.Fatalf("Bad entry %v", entry)
+	}
+	previous, ok := m.record("posts/article/one.md", one, []byte("second"))
+	if !ok || previous.Hash == m.Entries["posts/article/one.md"].Hash {
+		t.Fatalf("Didn't replace the entry %v", previous)
+	}
+	if len(m.tagged("code")) != 1 || len(m.tagged("missing")) != 0 {
+		t.Fatalf("Wrong tagged posts")
+	}
+	if _, ok := m.remove("/posts/article/one.md"); !ok || len(m.Entries) != 0 {
+		t.Fatalf("Didn't remove the entry %v", m.Entries)
+	}
+}
+
+func TestManifestRetag(t *testing.T) {
+	m := newManifest()
+	m.record("posts/one.md", FrontMatter{Tags: []string{"Code"}, Link: "one"}, []byte("one"))
+	m.record("posts/two.md", FrontMatter{Tags: []string{"code", "Lego"}, Link: "two"}, []byte("two"))
+	tags := m.retag(map[string][]FrontMatter{"code": {}, "gone": {}})
+	if len(tags) != 1 || len(tags["code"]) != 2 {
+		t.Fatalf("Wrong tags %v", tags)
+	}
+	if len(m.byLink()) != 2 {
+		t.Fatalf("Wrong links %v", m.byLink())
+	}
+}
+
+func TestManifestWriteAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	m := newManifest()
+	m.record("posts/one.md", FrontMatter{Title: "One", Type: "article", Link: "one"}, []byte("one"))
+	if err := m.write(dir); err != nil {
+		t.Fatalf("Failed to write %v", err)
+	}
+	loaded, err := loadManifest(dir)
+	if err != nil {
+		t.Fatalf("Failed to load %v", err)
+	}
+	if loaded.Entries["posts/one.md"].FrontMatter.Title != "One" || loaded.Generated.IsZero() {
+		t.Fatalf("Bad manifest %v", loaded)
+	}
+	if len(loaded.postsById()) != 1 {
+		t.Fatalf("Wrong feed posts %v", loaded.postsById())
+	}
+	if _, err := loadManifest(t.TempDir()); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing manifest %v", err)
+	}
+}
+
+func TestProcessMDFileUpdatesManifest(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previous := siteManifest
+	t.Cleanup(func() { siteManifest = previous })
+	siteManifest = newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md": "---\nTitle: One\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+
+	tags := map[string][]FrontMatter{}
+	postsById := map[string]Item{}
+	if _, err := processMDFile(&tags, &postsById, "/posts/article/one.md"); err != nil {
+		t.Fatalf("Failed to process %v", err)
+	}
+	if len(siteManifest.tagged("code")) != 1 {
+		t.Fatalf("Post not in the manifest %v", siteManifest.Entries)
+	}
+
+	// Retag and move the post, the old tag and page should go
+	os.WriteFile(filepath.Join(ConfigData.RepositoryDir, "posts/article/one.md"),
+		[]byte("---\nTitle: One\nTags: [Lego]\nCreated: 2024-06-01T10:00:00+1000\n---\nBody"), 0666)
+	tags = map[string][]FrontMatter{}
+	if _, err := processMDFile(&tags, &postsById, "/posts/article/one.md"); err != nil {
+		t.Fatalf("Failed to process %v", err)
+	}
+	if _, ok := tags["code"]; !ok {
+		t.Fatalf("Old tag not touched %v", tags)
+	}
+	if len(siteManifest.retag(tags)) != 1 {
+		t.Fatalf("Old tag not dropped %v", siteManifest.retag(tags))
+	}
+	if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, "posts/article/2024/05/one.html")); !os.IsNotExist(err) {
+		t.Fatalf("Old page not removed %v", err)
+	}
+	if len(postsById) != 1 {
+		t.Fatalf("Old post still in the feed %v", postsById)
+	}
+}
+
+func TestHashChanges(t *testing.T) {
+	keepConfig(t)
+	previous := siteManifest
+	t.Cleanup(func() { siteManifest = previous })
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/one.md":    "one",
+		"posts/two.md":    "two",
+		"posts/draft.md":  "draft",
+		"media/image.png": "image",
+	})
+	templateDir := writeTestRepository(t, map[string]string{"article.html": "article"})
+
+	siteManifest = newManifest()
+	changes, templates, err := hashChanges(templateDir)
+	if err != nil || len(changes.Added) != 4 || len(templates) != 1 {
+		t.Fatalf("Expected everything to be new %v %v %v", changes, templates, err)
+	}
+	for _, filename := range changes.Added {
+		siteManifest.recordSource(filename)
+	}
+	siteManifest.record("posts/one.md", FrontMatter{}, []byte("one"))
+	siteManifest.record("posts/gone.md", FrontMatter{}, []byte("gone"))
+	siteManifest.Sources["posts/gone.md"] = "gone"
+	siteManifest.Sources["posts/gonedraft.md"] = "gone"
+	siteManifest.Templates = templates
+
+	os.WriteFile(filepath.Join(ConfigData.RepositoryDir, "posts/two.md"), []byte("two, edited"), 0666)
+	changes, _, _ = hashChanges(templateDir)
+	if len(changes.Added) != 0 || len(changes.Modified) != 1 || changes.Modified[0] != "posts/two.md" {
+		t.Fatalf("Wrong changes %v", changes)
+	}
+	if len(changes.Deleted) != 1 || changes.Deleted[0] != "posts/gone.md" {
+		t.Fatalf("Wrong deletes %v", changes.Deleted)
+	}
+	if _, ok := siteManifest.Sources["posts/gonedraft.md"]; ok {
+		t.Fatalf("Deleted draft still in the manifest")
+	}
+
+	os.WriteFile(filepath.Join(templateDir, "article.html"), []byte("new article"), 0666)
+	changes, _, _ = hashChanges(templateDir)
+	if len(changes.Modified) != 3 {
+		t.Fatalf("Template change didn't modify every post %v", changes.Modified)
+	}
+}
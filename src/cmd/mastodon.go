@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mastodonSyndicator crossposts to a Mastodon account
+type mastodonSyndicator struct {
+	config Mastodon
+}
+
+func newMastodonSyndicator(config Syndics) (Syndicator, bool) {
+	return &mastodonSyndicator{config: config.Mastodon}, config.Mastodon.URL != ""
+}
+
+func init() {
+	registerSyndicator(newMastodonSyndicator)
+}
+
+func (s *mastodonSyndicator) Name() string {
+	return "Mastodon"
+}
+
+func (s *mastodonSyndicator) Wants(frontmatter FrontMatter) bool {
+	return postWantsMastodonCrosspost(frontmatter)
+}
+
+// Format is the synopsis, then what an indieweb post is about or the link to
+// the post, then the tags
+func (s *mastodonSyndicator) Format(frontmatter *FrontMatter) SyndicationMessage {
+	toSyndicate := frontmatter.Synopsis
+	if frontmatter.Type == "indieweb" {
+		toSyndicate = toSyndicate +
+			fmt.Sprintf("%s%s%s%s%s",
+				indieWeb(frontmatter.InReplyTo, "In reply to"),
+				indieWeb(frontmatter.RepostOf, "Repost of"),
+				indieWeb(frontmatter.LikeOf, "Like of"),
+				indieWeb(frontmatter.FavoriteOf, "Favourite of"),
+				indieWeb(frontmatter.BookmarkOf, "Bookmark of"),
+			)
+	} else {
+		toSyndicate = toSyndicate + "\n\n" + frontmatter.Link
+	}
+	if len(frontmatter.Tags) > 0 {
+		toSyndicate = toSyndicate + "\n#" + strings.Join(frontmatter.Tags, " #")
+	}
+	message := SyndicationMessage{
+		Text:      toSyndicate,
+		CreatedAt: frontmatter.CreatedDate,
+		Spoiler:   frontmatter.ContentWarning,
+		Language:  syndicationLanguage(),
+	}
+	for _, media := range syndicationMedia(frontmatter) {
+		if len(message.Media) < mastodonMediaLimit && mastodonAccepts(media.Type) {
+			message.Media = append(message.Media, media)
+		}
+	}
+	return message
+}
+
+// Mastodon takes up to four attachments a status
+var mastodonMediaLimit = 4
+
+// mastodonAccepts is true for the media types Mastodon can attach
+func mastodonAccepts(mediaType string) bool {
+	return (strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml") ||
+		strings.HasPrefix(mediaType, "video/") ||
+		strings.HasPrefix(mediaType, "audio/")
+}
+
+func (s *mastodonSyndicator) Post(message SyndicationMessage) (string, error) {
+	type mastodonMostResponse struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	data := url.Values{
+		"status":     {message.Text},
+		"visibility": {"public"}, // testing
+	}
+	for _, media := range message.Media {
+		id, err := s.uploadMedia(media)
+		if err != nil {
+			// Better the status without the attachment than no status at all
+			buildReport.add(media.Filename, "crosspost", fmt.Errorf("mastodon status posted without it %v", err))
+			continue
+		}
+		data.Add("media_ids[]", id)
+	}
+	if message.Spoiler != "" {
+		data.Set("spoiler_text", message.Spoiler)
+		data.Set("sensitive", "true")
+	}
+	if message.Language != "" {
+		data.Set("language", message.Language)
+	}
+	request, _ := http.NewRequest(
+		"POST",
+		s.config.URL+"v1/statuses",
+		bytes.NewBuffer([]byte(data.Encode())),
+	)
+	request.Header.Set(jsonHeaders[0][0], jsonHeaders[0][1])
+	request.Header.Set("Content-type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "Bearer "+s.config.Token)
+	resp, err := Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var res mastodonMostResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("failed in posting to mastodon [%d]", resp.StatusCode)
+	}
+	if res.URL != "" {
+		return res.URL, nil
+	}
+	if res.ID != "" {
+		return url.JoinPath(`https://mstdn.social/@vonExplaino/`, res.ID)
+	}
+	return "", fmt.Errorf("failed in post to mastodon attempt %v|%d", res, resp.StatusCode)
+}
+
+// uploadMedia sends an attachment with its alt text, returning its id
+func (s *mastodonSyndicator) uploadMedia(media SyndicationMedia) (string, error) {
+	file, err := os.Open(media.Filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filepath.Base(media.Filename)))
+	header.Set("Content-Type", media.Type)
+	part, _ := form.CreatePart(header)
+	if _, err = io.Copy(part, file); err != nil {
+		return "", err
+	}
+	if media.Alt != "" {
+		form.WriteField("description", media.Alt)
+	}
+	form.Close()
+
+	request, _ := http.NewRequest("POST", s.config.URL+"v2/media", body)
+	request.Header.Set("Content-type", form.FormDataContentType())
+	request.Header.Set("Authorization", "Bearer "+s.config.Token)
+	resp, err := Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&res)
+	if (resp.StatusCode != 200 && resp.StatusCode != 202) || res.ID == "" {
+		return "", fmt.Errorf("failed to upload %s to mastodon [%d]", filepath.Base(media.Filename), resp.StatusCode)
+	}
+	// 202 is uploaded, but still being processed, and a status can't use it yet
+	if resp.StatusCode == 202 {
+		if err := s.waitForMedia(res.ID); err != nil {
+			return "", fmt.Errorf("%s %v", filepath.Base(media.Filename), err)
+		}
+	}
+	return res.ID, nil
+}
+
+// How often, and how many times, to check on media Mastodon is processing
+var mastodonMediaWait = time.Second
+var mastodonMediaChecks = 60
+
+// waitForMedia waits until Mastodon has finished processing the media, which
+// is when it has a url
+func (s *mastodonSyndicator) waitForMedia(id string) error {
+	for check := 0; check < mastodonMediaChecks; check++ {
+		time.Sleep(mastodonMediaWait)
+		request, _ := http.NewRequest("GET", s.config.URL+"v1/media/"+id, nil)
+		request.Header.Set("Authorization", "Bearer "+s.config.Token)
+		resp, err := Client.Do(request)
+		if err != nil {
+			return err
+		}
+		var res struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if resp.StatusCode == 200 && res.URL != "" {
+			return nil
+		}
+		// 206 is still processing
+		if resp.StatusCode != 200 && resp.StatusCode != 206 {
+			return fmt.Errorf("failed processing on mastodon [%d]", resp.StatusCode)
+		}
+	}
+	return fmt.Errorf("still processing on mastodon after %v", time.Duration(mastodonMediaChecks)*mastodonMediaWait)
+}
+
+func (s *mastodonSyndicator) RecordLink(filename string, frontmatter *FrontMatter, link string) error {
+	frontmatter.SyndicationLinks.Mastodon = link
+	return setMastodonLink(filename, link)
+}
+
+func indieWeb(link, label string) string {
+	if len(link) > 0 {
+		return fmt.Sprintf("\n\n%s %s", label, link)
+	}
+	return ""
+}
+
+func postWantsMastodonCrosspost(fm FrontMatter) bool {
+	return wantsSyndication(fm.SyndicationLinks.Mastodon)
+}
+
+func setMastodonLink(filename string, mastodonLink string) error {
+	return setSyndicationLink(filename, "Mastodon", mastodonLink)
+}
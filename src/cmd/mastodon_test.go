@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/colinmo/vonblog/utils/mocks"
+)
+
+func TestMastodonMediaAndContentWarning(t *testing.T) {
+	keepConfig(t)
+	previousClient, previousWait := Client, mastodonMediaWait
+	t.Cleanup(func() { Client, mastodonMediaWait = previousClient, previousWait })
+	mastodonMediaWait = 0
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"media/2024/05/one.png":   "\x89PNG\r\n\x1a\n one",
+		"media/2024/05/two.jpg":   "\xff\xd8\xff\xe0 two",
+		"media/2024/05/three.svg": `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+	})
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Language = "en-au"
+	target := &mastodonSyndicator{config: Mastodon{URL: "https://mstdn.example.com/api/", Token: "token"}}
+	frontmatter := FrontMatter{
+		Synopsis:       "Pictures",
+		Link:           "https://vonexplaino.com/blog/pictures.html",
+		FeatureImage:   "/blog/media/2024/05/one.png",
+		AttachedMedia:  []string{"/blog/media/2024/05/three.svg", "/blog/media/2024/05/two.jpg", "/blog/media/2024/05/missing.jpg"},
+		MediaAlt:       map[string]string{"/blog/media/2024/05/two.jpg": "The second"},
+		Content:        `<p><img src="/blog/media/2024/05/one.png" alt="A &amp; B"></p>`,
+		ContentWarning: "Spiders",
+	}
+	uploads := []string{}
+	checks := 0
+	var status url.Values
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == "https://mstdn.example.com/api/v2/media" {
+			_, params, _ := mime.ParseMediaType(req.Header.Get("Content-type"))
+			form, err := multipart.NewReader(req.Body, params["boundary"]).ReadForm(1 << 20)
+			if err != nil || len(form.File["file"]) != 1 {
+				t.Fatalf("Bad upload %v", err)
+			}
+			uploads = append(uploads, form.File["file"][0].Filename+" "+form.File["file"][0].Header.Get("Content-Type")+" "+form.Value["description"][0])
+			return &http.Response{StatusCode: 202, Body: io.NopCloser(strings.NewReader(`{"id":"media` + form.File["file"][0].Filename + `"}`))}, nil
+		}
+		if req.Method == "GET" {
+			// Still processing one.png the first time it's checked
+			checks++
+			if checks == 1 {
+				return &http.Response{StatusCode: 206, Body: io.NopCloser(strings.NewReader(`{"id":"mediaone.png","url":null}`))}, nil
+			}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"id":"media","url":"https://mstdn.example.com/media.png"}`))}, nil
+		}
+		if len(uploads) != 2 || checks != 3 {
+			t.Fatalf("Status posted before the media was ready %v %d", uploads, checks)
+		}
+		body, _ := io.ReadAll(req.Body)
+		status, _ = url.ParseQuery(string(body))
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"id":"1","url":"https://mstdn.example.com/@professor/1"}`))}, nil
+	}
+
+	link, err := target.Post(target.Format(&frontmatter))
+	if err != nil || link != "https://mstdn.example.com/@professor/1" {
+		t.Fatalf("Failed to post %s %v", link, err)
+	}
+	if strings.Join(uploads, "|") != "one.png image/png A & B|two.jpg image/jpeg The second" {
+		t.Fatalf("Wrong uploads %v", uploads)
+	}
+	if strings.Join(status["media_ids[]"], ",") != "mediaone.png,mediatwo.jpg" || status.Get("spoiler_text") != "Spiders" ||
+		status.Get("sensitive") != "true" || status.Get("language") != "en" {
+		t.Fatalf("Wrong status %v", status)
+	}
+}
+
+func TestMastodonMediaStillProcessing(t *testing.T) {
+	keepConfig(t)
+	previousClient, previousWait, previousReport := Client, mastodonMediaWait, buildReport
+	t.Cleanup(func() { Client, mastodonMediaWait, buildReport = previousClient, previousWait, previousReport })
+	mastodonMediaWait = 0
+	buildReport = newBuildReport()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"media/2024/05/clip.mp4": "\x00\x00\x00\x18ftypmp42 video",
+	})
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	target := &mastodonSyndicator{config: Mastodon{URL: "https://mstdn.example.com/api/", Token: "token"}}
+	var status url.Values
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "v2/media"):
+			return &http.Response{StatusCode: 202, Body: io.NopCloser(strings.NewReader(`{"id":"clip"}`))}, nil
+		case req.Method == "GET":
+			return &http.Response{StatusCode: 206, Body: io.NopCloser(strings.NewReader(`{"id":"clip","url":null}`))}, nil
+		}
+		body, _ := io.ReadAll(req.Body)
+		status, _ = url.ParseQuery(string(body))
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"id":"1"}`))}, nil
+	}
+	frontmatter := FrontMatter{Synopsis: "A clip", AttachedMedia: []string{"/blog/media/2024/05/clip.mp4"}}
+	if _, err := target.Post(target.Format(&frontmatter)); err != nil {
+		t.Fatalf("Status not posted without the media %v", err)
+	}
+	if status == nil || status.Get("status") == "" || len(status["media_ids[]"]) != 0 {
+		t.Fatalf("Status posted with unprocessed media %v", status)
+	}
+	if len(buildReport.Errors) != 1 || !strings.Contains(buildReport.Errors[0].Error, "clip.mp4 still processing") {
+		t.Fatalf("Unprocessed media not reported %v", buildReport.Errors)
+	}
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var feedsOPMLFilename = "feeds.opml"
+var blogrollOPMLFilename = "blogroll.opml"
+var blogrollHTMLFilename = "blogroll.html"
+
+// The blogroll kept with the posts, added to the one in the config
+var blogrollFilename = "blogroll.yaml"
+
+// BlogrollEntry is a site recommended in the blogroll
+type BlogrollEntry struct {
+	Title       string `yaml:"title"`
+	Feed        string `yaml:"feed"`
+	Site        string `yaml:"site"`
+	Description string `yaml:"description"`
+	Category    string `yaml:"category"`
+}
+
+type OPMLOutline struct {
+	Text        string        `xml:"text,attr"`
+	Title       string        `xml:"title,attr,omitempty"`
+	Type        string        `xml:"type,attr,omitempty"`
+	XMLURL      string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string        `xml:"htmlUrl,attr,omitempty"`
+	Description string        `xml:"description,attr,omitempty"`
+	Outlines    []OPMLOutline `xml:"outline"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated"`
+	OwnerName   string `xml:"ownerName,omitempty"`
+	OwnerEmail  string `xml:"ownerEmail,omitempty"`
+	Docs        string `xml:"docs"`
+}
+
+type OPML struct {
+	XMLName  xml.Name      `xml:"opml"`
+	Version  string        `xml:"version,attr"`
+	Head     OPMLHead      `xml:"head"`
+	Outlines []OPMLOutline `xml:"body>outline"`
+}
+
+// BlogrollCategory is the blogroll entries under one heading, for the template
+type BlogrollCategory struct {
+	Name    string
+	Entries []BlogrollEntry
+}
+
+// writeOPMLFiles writes the OPML of the site and tag feeds, and the blogroll
+// as OPML and as a page
+func writeOPMLFiles() {
+	if siteManifest.Partial {
+		// It would only have the tags of the posts the manifest knows about
+		PrintIfNotSilent("No full build manifest, leaving the feeds OPML until a full regenerate\n")
+	} else {
+		buildReport.add(feedsOPMLFilename, "opml", WriteOPML(tagFeedsOPML(siteManifest.tagNames()), feedsOPMLFilename))
+	}
+	blogroll, err := readBlogroll()
+	buildReport.add(blogrollFilename, "opml", err)
+	if len(blogroll) == 0 {
+		return
+	}
+	buildReport.add(blogrollOPMLFilename, "opml", WriteOPML(blogrollOPML(blogroll), blogrollOPMLFilename))
+	buildReport.add(blogrollHTMLFilename, "opml", WriteBlogrollHTML(blogroll, blogrollHTMLFilename))
+}
+
+// tagNames is every tag on a live post in the manifest, sorted
+func (m *Manifest) tagNames() []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, entry := range m.Entries {
+		if isRetired(entry.FrontMatter) {
+			continue
+		}
+		for _, tag := range entry.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// tagFeedsOPML lists the site feed, then the feed written for each tag
+func tagFeedsOPML(tags []string) OPML {
+	latest, _ := feedChannel("latest", FeedVars{})
+	latestLink, _ := url.JoinPath(ConfigData.BaseURL, "rss.xml")
+	doc := OPML{Head: OPMLHead{Title: latest.Title + " feeds"}}
+	doc.Outlines = append(doc.Outlines, OPMLOutline{
+		Text:        latest.Title,
+		Title:       latest.Title,
+		Type:        "rss",
+		XMLURL:      latestLink,
+		HTMLURL:     ConfigData.BaseURL,
+		Description: latest.Description,
+	})
+	tagOutlines := OPMLOutline{Text: "Tags", Title: "Tags"}
+	for _, tag := range tags {
+		vars := FeedVars{Tag: tag, Slug: textToSlug(tag)}
+		channel, _ := feedChannel("tag", vars)
+		feedLink, _ := url.JoinPath(ConfigData.BaseURL, "tag", vars.Slug+".xml")
+		pageLink, _ := url.JoinPath(ConfigData.BaseURL, "tag", vars.Slug+"-1.html")
+		tagOutlines.Outlines = append(tagOutlines.Outlines, OPMLOutline{
+			Text:        tag,
+			Title:       channel.Title,
+			Type:        "rss",
+			XMLURL:      feedLink,
+			HTMLURL:     pageLink,
+			Description: channel.Description,
+		})
+	}
+	if len(tagOutlines.Outlines) > 0 {
+		doc.Outlines = append(doc.Outlines, tagOutlines)
+	}
+	return doc
+}
+
+// readBlogroll is the blogroll from the config, then the one in the
+// repository, skipping feeds already listed
+func readBlogroll() ([]BlogrollEntry, error) {
+	blogroll := []BlogrollEntry{}
+	seen := map[string]bool{}
+	add := func(entries []BlogrollEntry) {
+		for _, entry := range entries {
+			if entry.Feed == "" || seen[entry.Feed] {
+				continue
+			}
+			seen[entry.Feed] = true
+			if entry.Title == "" {
+				entry.Title = entry.Feed
+			}
+			blogroll = append(blogroll, entry)
+		}
+	}
+	add(ConfigData.Blogroll)
+	content, err := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, blogrollFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return blogroll, nil
+	}
+	if err != nil {
+		return blogroll, err
+	}
+	var fromRepository []BlogrollEntry
+	if err = yaml.Unmarshal(content, &fromRepository); err != nil {
+		return blogroll, fmt.Errorf("could not read %s %v", blogrollFilename, err)
+	}
+	add(fromRepository)
+	return blogroll, nil
+}
+
+// blogrollCategories groups the blogroll by category, in the order they
+// first appear
+func blogrollCategories(blogroll []BlogrollEntry) []BlogrollCategory {
+	categories := []BlogrollCategory{}
+	index := map[string]int{}
+	for _, entry := range blogroll {
+		i, ok := index[entry.Category]
+		if !ok {
+			i = len(categories)
+			index[entry.Category] = i
+			categories = append(categories, BlogrollCategory{Name: entry.Category})
+		}
+		categories[i].Entries = append(categories[i].Entries, entry)
+	}
+	return categories
+}
+
+// blogrollOPML is the blogroll with an outline for each category, and the
+// uncategorised sites at the top
+func blogrollOPML(blogroll []BlogrollEntry) OPML {
+	doc := OPML{Head: OPMLHead{Title: ConfigData.Metadata.Title + " blogroll"}}
+	for _, category := range blogrollCategories(blogroll) {
+		outlines := []OPMLOutline{}
+		for _, entry := range category.Entries {
+			outlines = append(outlines, OPMLOutline{
+				Text:        entry.Title,
+				Title:       entry.Title,
+				Type:        "rss",
+				XMLURL:      entry.Feed,
+				HTMLURL:     entry.Site,
+				Description: entry.Description,
+			})
+		}
+		if category.Name == "" {
+			doc.Outlines = append(doc.Outlines, outlines...)
+			continue
+		}
+		doc.Outlines = append(doc.Outlines, OPMLOutline{Text: category.Name, Title: category.Name, Outlines: outlines})
+	}
+	return doc
+}
+
+// WriteOPML writes the outlines as an OPML 2.0 file into the BaseDir
+func WriteOPML(doc OPML, filename string) error {
+	owner := webmasterPerson()
+	doc.Version = "2.0"
+	doc.Head.DateCreated = DateOfExecution.Format(time.RFC1123Z)
+	doc.Head.OwnerName = owner.Name
+	doc.Head.OwnerEmail = owner.Email
+	doc.Head.Docs = "http://opml.org/spec2.opml"
+	byteValue, err := xml.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ConfigData.BaseDir, filename), append([]byte(xml.Header), byteValue...), 0777)
+}
+
+// WriteBlogrollHTML writes the blogroll page with the blogroll template
+func WriteBlogrollHTML(blogroll []BlogrollEntry, filename string) error {
+	buf := bytes.NewBufferString("")
+	opmlLink, _ := url.JoinPath(ConfigData.BaseURL, blogrollOPMLFilename)
+	link, _ := url.JoinPath(ConfigData.BaseURL, filename)
+	if err := templ.ExecuteTemplate(
+		buf,
+		"blogroll",
+		map[string]interface{}{
+			"title":        "Blogroll",
+			"synopsis":     "Sites worth following",
+			"link":         link,
+			"base_url":     ConfigData.BaseURL,
+			"created_date": DateOfExecution,
+			"updated_date": DateOfExecution,
+			"categories":   blogrollCategories(blogroll),
+			"opml":         opmlLink,
+		},
+	); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(ConfigData.BaseDir, filename), buf.Bytes(), 0777)
+}
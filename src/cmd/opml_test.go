@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteOPMLFiles(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousManifest, previousReport := siteManifest, buildReport
+	t.Cleanup(func() { siteManifest, buildReport = previousManifest, previousReport })
+	buildReport = newBuildReport()
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Title = "Professor von Explaino"
+	ConfigData.Metadata.Webmaster = `professor@vonexplaino.com (Colin Morris)`
+	ConfigData.Blogroll = []BlogrollEntry{
+		{Title: "Friend", Feed: "https://friend.example.com/feed.xml", Site: "https://friend.example.com/", Category: "Friends"},
+	}
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"blogroll.yaml": "- title: Other\n  feed: https://other.example.com/rss\n- title: Friend again\n  feed: https://friend.example.com/feed.xml\n",
+	})
+	siteManifest = newManifest()
+	siteManifest.Entries["posts/article/a.md"] = ManifestEntry{Tags: []string{"Steampunk", "Code"}}
+	siteManifest.Entries["posts/article/b.md"] = ManifestEntry{Tags: []string{"Gone"}, FrontMatter: FrontMatter{Status: "retired"}}
+
+	writeOPMLFiles()
+	if len(buildReport.Errors) > 0 {
+		t.Fatalf("Failed to write the OPML %v", buildReport.Errors)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, feedsOPMLFilename))
+	var feeds OPML
+	if err := xml.Unmarshal(content, &feeds); err != nil {
+		t.Fatalf("Not valid XML %v\n%s", err, content)
+	}
+	if feeds.Version != "2.0" || feeds.Head.OwnerEmail != "professor@vonexplaino.com" || len(feeds.Outlines) != 2 || feeds.Outlines[0].XMLURL != "https://vonexplaino.com/blog/rss.xml" {
+		t.Fatalf("Wrong feeds OPML %v", feeds)
+	}
+	tags := feeds.Outlines[1].Outlines
+	if len(tags) != 2 || tags[0].Text != "Code" || tags[0].XMLURL != "https://vonexplaino.com/blog/tag/code.xml" || tags[1].HTMLURL != "https://vonexplaino.com/blog/tag/steampunk-1.html" {
+		t.Fatalf("Wrong tag feeds %v", tags)
+	}
+
+	content, _ = os.ReadFile(filepath.Join(ConfigData.BaseDir, blogrollOPMLFilename))
+	var blogroll OPML
+	xml.Unmarshal(content, &blogroll)
+	if len(blogroll.Outlines) != 2 || blogroll.Outlines[0].Text != "Friends" || blogroll.Outlines[0].Outlines[0].XMLURL != "https://friend.example.com/feed.xml" ||
+		blogroll.Outlines[1].XMLURL != "https://other.example.com/rss" {
+		t.Fatalf("Wrong blogroll OPML %v", blogroll)
+	}
+	content, _ = os.ReadFile(filepath.Join(ConfigData.BaseDir, blogrollHTMLFilename))
+	if !strings.Contains(string(content), `<h2>Friends</h2><a href="https://friend.example.com/">Friend</a>`) || strings.Contains(string(content), "Friend again") {
+		t.Fatalf("Wrong blogroll page %s", content)
+	}
+
+	// Without a full manifest the tags would be missing, so the last one stays
+	siteManifest.Partial = true
+	siteManifest.Entries = map[string]ManifestEntry{"posts/article/c.md": {Tags: []string{"Code"}}}
+	writeOPMLFiles()
+	content, _ = os.ReadFile(filepath.Join(ConfigData.BaseDir, feedsOPMLFilename))
+	if !strings.Contains(string(content), "Steampunk") {
+		t.Fatalf("Tags dropped from the feeds OPML\n%s", content)
+	}
+}
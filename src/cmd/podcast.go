@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var podcastFilename = "podcast.xml"
+
+type PodcastImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type PodcastLink struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type PodcastOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email"`
+}
+
+type PodcastCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+type PodcastItem struct {
+	XMLName         xml.Name      `xml:"item"`
+	Title           string        `xml:"title"`
+	Description     string        `xml:"description"`
+	ContentEncoded  string        `xml:"content:encoded,omitempty"`
+	Link            string        `xml:"link"`
+	GUID            string        `xml:"guid"`
+	PublicationDate string        `xml:"pubDate"`
+	PubDateAsDate   time.Time     `xml:"-"`
+	Enclosure       Enclosure     `xml:"enclosure"`
+	Duration        string        `xml:"itunes:duration,omitempty"`
+	Season          int           `xml:"itunes:season,omitempty"`
+	Episode         int           `xml:"itunes:episode,omitempty"`
+	EpisodeType     string        `xml:"itunes:episodeType,omitempty"`
+	Explicit        string        `xml:"itunes:explicit"`
+	Image           *PodcastImage `xml:"itunes:image,omitempty"`
+	Transcript      *PodcastLink  `xml:"podcast:transcript,omitempty"`
+	Chapters        *PodcastLink  `xml:"podcast:chapters,omitempty"`
+}
+
+type PodcastChannel struct {
+	XMLName       xml.Name `xml:"channel"`
+	Title         string   `xml:"title"`
+	Link          string   `xml:"link"`
+	Description   string   `xml:"description"`
+	Language      string   `xml:"language"`
+	Copyright     string   `xml:"copyright"`
+	LastBuildDate string   `xml:"lastBuildDate"`
+	Generator     string   `xml:"generator"`
+	AtomLinks     []AtomLink
+	Author        string           `xml:"itunes:author"`
+	Owner         PodcastOwner     `xml:"itunes:owner"`
+	Image         *PodcastImage    `xml:"itunes:image,omitempty"`
+	Category      *PodcastCategory `xml:"itunes:category,omitempty"`
+	Explicit      string           `xml:"itunes:explicit"`
+	Type          string           `xml:"itunes:type"`
+	Items         []PodcastItem    `xml:"item"`
+}
+
+type PodcastRSS struct {
+	XMLName      xml.Name       `xml:"rss"`
+	Version      string         `xml:"version,attr"`
+	XmlnsAtom    string         `xml:"xmlns:atom,attr"`
+	XmlnsItunes  string         `xml:"xmlns:itunes,attr"`
+	XmlnsPodcast string         `xml:"xmlns:podcast,attr"`
+	XmlnsContent string         `xml:"xmlns:content,attr"`
+	Channel      PodcastChannel `xml:"channel"`
+}
+
+// WritePodcast writes the episodes as an iTunes and Podcasting 2.0 feed into
+// the BaseDir. Episodes without their audio in the media directory are left
+// out, and returned as the error.
+func WritePodcast(episodes []FrontMatter, filename string) error {
+	author := webmasterPerson()
+	feed := PodcastRSS{
+		Version:      "2.0",
+		XmlnsAtom:    "http://www.w3.org/2005/Atom",
+		XmlnsItunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		XmlnsPodcast: "https://podcastindex.org/namespace/1.0",
+		XmlnsContent: "http://purl.org/rss/1.0/modules/content/",
+		Channel: PodcastChannel{
+			Title:         ConfigData.Podcast.Title,
+			Link:          ConfigData.BaseURL,
+			Description:   ConfigData.Podcast.Description,
+			Language:      ConfigData.Metadata.Language,
+			Copyright:     "Creative Commons 3.0 with Attribution",
+			LastBuildDate: DateOfExecution.Format(time.RFC1123Z),
+			Generator:     "Ridiculous Go Homebrew",
+			Author:        ConfigData.Podcast.Author,
+			Owner:         PodcastOwner{Name: ConfigData.Podcast.Author, Email: ConfigData.Podcast.Email},
+			Explicit:      fmt.Sprintf("%t", ConfigData.Podcast.Explicit),
+			Type:          "episodic",
+			Items:         []PodcastItem{},
+		},
+	}
+	selfLink, _ := url.JoinPath(ConfigData.BaseURL, filename)
+	feed.Channel.AtomLinks = append([]AtomLink{{Href: selfLink, Rel: "self", Type: "application/rss+xml"}}, hubLinks()...)
+	if feed.Channel.Title == "" {
+		feed.Channel.Title = ConfigData.Metadata.Title
+	}
+	if feed.Channel.Description == "" {
+		feed.Channel.Description = ConfigData.Metadata.Description
+	}
+	if feed.Channel.Author == "" {
+		feed.Channel.Author = author.Name
+		feed.Channel.Owner.Name = author.Name
+	}
+	if feed.Channel.Owner.Email == "" {
+		feed.Channel.Owner.Email = author.Email
+	}
+	if ConfigData.Podcast.Image != "" {
+		feed.Channel.Image = &PodcastImage{Href: absoluteLink(ConfigData.Podcast.Image)}
+	}
+	if ConfigData.Podcast.Category != "" {
+		feed.Channel.Category = &PodcastCategory{Text: ConfigData.Podcast.Category}
+	}
+
+	missing := []string{}
+	for _, episode := range episodes {
+		item, ok := PostToPodcastItem(episode)
+		if !ok {
+			missing = append(missing, episode.Episode.Audio)
+			continue
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	sort.SliceStable(feed.Channel.Items, func(p, q int) bool {
+		return feed.Channel.Items[p].PubDateAsDate.After(feed.Channel.Items[q].PubDateAsDate)
+	})
+
+	byteValue, err := xml.MarshalIndent(feed, "", "    ")
+	if err != nil {
+		return err
+	}
+	err = writeFeed(filename, append([]byte(xml.Header), byteValue...), true)
+	if err == nil && len(missing) > 0 {
+		err = fmt.Errorf("no audio for the episodes %s", strings.Join(missing, ", "))
+	}
+	return err
+}
+
+// PostToPodcastItem is the episode as a podcast item, false if its audio
+// isn't in the media directory
+func PostToPodcastItem(frontmatter FrontMatter) (PodcastItem, bool) {
+	episode := frontmatter.Episode
+	enclosure, ok := mediaEnclosure(episode.Audio)
+	if !ok {
+		return PodcastItem{}, false
+	}
+	item := PodcastItem{
+		Title:           frontmatter.Title,
+		Description:     frontmatter.Synopsis,
+		ContentEncoded:  frontmatter.Content,
+		Link:            frontmatter.Link,
+		GUID:            frontmatter.Link,
+		PublicationDate: frontmatter.CreatedDate.Format(time.RFC1123Z),
+		PubDateAsDate:   frontmatter.CreatedDate,
+		Enclosure:       enclosure,
+		Duration:        episode.Duration,
+		Season:          episode.Season,
+		Episode:         episode.Number,
+		EpisodeType:     episode.Kind,
+		Explicit:        fmt.Sprintf("%t", episode.Explicit),
+	}
+	switch strings.ToLower(filepath.Ext(frontmatter.FeatureImage)) {
+	case ".jpg", ".jpeg", ".png":
+		item.Image = &PodcastImage{Href: absoluteLink(frontmatter.FeatureImage)}
+	}
+	if episode.Transcript != "" {
+		item.Transcript = &PodcastLink{URL: absoluteLink(episode.Transcript), Type: transcriptType(episode.Transcript)}
+	}
+	if episode.Chapters != "" {
+		item.Chapters = &PodcastLink{URL: absoluteLink(episode.Chapters), Type: "application/json+chapters"}
+	}
+	return item, true
+}
+
+// transcriptType is the MIME type of a transcript, by its extension
+func transcriptType(link string) string {
+	switch ext := strings.ToLower(filepath.Ext(link)); ext {
+	case ".vtt":
+		return "text/vtt"
+	case ".srt":
+		return "application/x-subrip"
+	default:
+		if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+			return strings.Split(mimeType, ";")[0]
+		}
+	}
+	return "text/plain"
+}
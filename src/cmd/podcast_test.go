@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEpisodeValidate(t *testing.T) {
+	if errs := episodeValidate(Episode{Audio: "/blog/media/ep1.mp3", Duration: "1:02:03", Kind: "full"}); len(errs) != 0 {
+		t.Fatalf("Good episode failed %v", errs)
+	}
+	if errs := episodeValidate(Episode{Duration: "an hour", Kind: "extra"}); len(errs) != 3 {
+		t.Fatalf("Bad episode passed %v", errs)
+	}
+	frontmatter, err := parseFrontMatter("Title: Pilot\nType: episode\nCreated: 2024-05-01T10:00:00+1000\nEpisode:\n  Audio: /blog/media/2024/05/pilot.mp3\n  Duration: \"3600\"\n  Season: 1\n  Number: 1\n", "")
+	if err != nil || frontmatter.Type != "episode" || frontmatter.Episode.Number != 1 || frontmatter.Episode.Duration != "3600" {
+		t.Fatalf("Episode didn't parse %v %v", frontmatter, err)
+	}
+}
+
+func TestWritePodcast(t *testing.T) {
+	keepConfig(t)
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"media/2024/05/pilot.mp3": "ID3\x03\x00\x00\x00\x00\x00\x00 audio",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Webmaster = `professor@vonexplaino.com (Colin Morris)`
+	ConfigData.Podcast = Podcast{Title: "The Show", Category: "Technology", Image: "/blog/media/show.jpg"}
+	created, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	episodes := []FrontMatter{
+		{Title: "Pilot", Type: "episode", Link: "https://vonexplaino.com/blog/posts/episode/2024/05/pilot.html", CreatedDate: created, FeatureImage: "/blog/media/2024/05/pilot.png",
+			Episode: Episode{Audio: "/blog/media/2024/05/pilot.mp3", Duration: "3600", Season: 1, Number: 1, Kind: "full", Transcript: "/blog/media/2024/05/pilot.vtt", Chapters: "/blog/media/2024/05/pilot.json"}},
+		{Title: "Lost", Type: "episode", Link: "https://vonexplaino.com/blog/posts/episode/2024/05/lost.html", CreatedDate: created,
+			Episode: Episode{Audio: "/blog/media/2024/05/lost.mp3"}},
+	}
+
+	err := WritePodcast(episodes, podcastFilename)
+	if err == nil || !strings.Contains(err.Error(), "lost.mp3") {
+		t.Fatalf("Missing audio not reported %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, podcastFilename))
+	for _, expected := range []string{
+		`xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"`,
+		`<title>The Show</title>`,
+		`<itunes:owner>`,
+		`<itunes:email>professor@vonexplaino.com</itunes:email>`,
+		`<itunes:image href="https://vonexplaino.com/blog/media/show.jpg"></itunes:image>`,
+		`<itunes:category text="Technology"></itunes:category>`,
+		`<enclosure url="https://vonexplaino.com/blog/media/2024/05/pilot.mp3" length="16" type="audio/mpeg"></enclosure>`,
+		`<itunes:duration>3600</itunes:duration>`,
+		`<itunes:season>1</itunes:season>`,
+		`<itunes:episode>1</itunes:episode>`,
+		`<itunes:explicit>false</itunes:explicit>`,
+		`<podcast:transcript url="https://vonexplaino.com/blog/media/2024/05/pilot.vtt" type="text/vtt"></podcast:transcript>`,
+		`<podcast:chapters url="https://vonexplaino.com/blog/media/2024/05/pilot.json" type="application/json+chapters"></podcast:chapters>`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Fatalf("Missing %s from the podcast feed\n%s", expected, content)
+		}
+	}
+	if strings.Contains(string(content), "lost.html") {
+		t.Fatalf("Episode without audio in the feed\n%s", content)
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// publishDueCmd publishes the scheduled posts whose time has come
+var publishDueCmd = &cobra.Command{
+	Use:   "publish-due",
+	Short: "Publish scheduled posts that are due",
+	Long: `Publishes the posts with a Created or PublishAt date in the future that have since come due, then regenerates their tags, the index and the feeds and crossposts them.
+
+Posts are scheduled by an update, so run this from cron after the updates. Exits with 3 if anything failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupTemplate()
+		if !loadSiteManifest() {
+			log.Fatalf("No build manifest in %s, run an update first\n", manifestDir())
+		}
+		due := siteManifest.due(DateOfExecution)
+		if DryRun {
+			fmt.Printf("Due (%d):\n", len(due))
+			for _, filename := range due {
+				fmt.Printf("  %s\n", filename)
+			}
+			return
+		}
+		if len(due) == 0 {
+			PrintIfNotSilent("Nothing due\n")
+			return
+		}
+		PrintIfNotSilent(fmt.Sprintf("Publishing %s\n", strings.Join(due, ", ")))
+		buildReport = newBuildReport()
+		buildReport.Mode = "publish-due"
+		changes := GitDiffs{Modified: due}
+		tags, postsById := processFileUpdates(changes, map[string][]FrontMatter{}, siteManifest.postsById())
+		deleteAndRegenerate(RSS{}, tags, postsById, map[string]struct{}{}, changes)
+		finishBuild()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(publishDueCmd)
+	publishDueCmd.Flags().BoolVarP(&DryRun, "dry-run", "n", false, "List the posts that are due without publishing them")
+	publishDueCmd.Flags().BoolVarP(&Silent, "silent", "s", false, "Run silently")
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledPostsArePublishedWhenDue(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousDate, previousReport, previousManifest := DateOfExecution, buildReport, siteManifest
+	t.Cleanup(func() { DateOfExecution, buildReport, siteManifest = previousDate, previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/later.md":  "---\nTitle: Later\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\nPublishAt: 2024-06-01T10:00:00+1000\n---\nBody",
+		"posts/article/future.md": "---\nTitle: Future\nCreated: 2024-07-01T10:00:00+1000\n---\nBody",
+		"posts/article/now.md":    "---\nTitle: Now\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	DateOfExecution, _ = time.Parse(time.RFC3339, "2024-05-15T00:00:00+10:00")
+
+	changes := GitDiffs{Added: []string{"posts/article/future.md", "posts/article/later.md", "posts/article/now.md"}}
+	tags, postsById := processFileUpdates(changes, map[string][]FrontMatter{}, map[string]Item{})
+	if len(postsById) != 1 || len(tags) != 0 {
+		t.Fatalf("Scheduled posts were published %v %v", postsById, tags)
+	}
+	if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, "posts/article/2024/05/later.html")); !os.IsNotExist(err) {
+		t.Fatalf("Scheduled post was written %v", err)
+	}
+	if len(siteManifest.Scheduled) != 2 || len(siteManifest.due(DateOfExecution)) != 0 {
+		t.Fatalf("Wrong schedule %v", siteManifest.Scheduled)
+	}
+
+	DateOfExecution = DateOfExecution.AddDate(0, 1, 0)
+	due := siteManifest.due(DateOfExecution)
+	if len(due) != 1 || due[0] != "posts/article/later.md" {
+		t.Fatalf("Wrong posts due %v", due)
+	}
+	tags, postsById = processFileUpdates(GitDiffs{Modified: due}, map[string][]FrontMatter{}, postsById)
+	if len(postsById) != 2 || len(tags["code"]) != 1 || len(siteManifest.Scheduled) != 1 {
+		t.Fatalf("Due post wasn't published %v %v %v", postsById, tags, siteManifest.Scheduled)
+	}
+	if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, "posts/article/2024/05/later.html")); err != nil {
+		t.Fatalf("Due post wasn't written %v", err)
+	}
+	if len(buildReport.Errors) != 0 {
+		t.Fatalf("Errors publishing %v", buildReport.Errors)
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var redirectPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Moved</title>
+	<link rel="canonical" href="%[1]s">
+	<meta name="robots" content="noindex">
+	<meta http-equiv="refresh" content="0; url=%[1]s">
+</head>
+<body>
+	<p>This post has moved to <a href="%[1]s">%[1]s</a>.</p>
+</body>
+</html>
+`
+
+// How redirects are written if the config doesn't say
+var defaultRedirectFormats = []string{"stub"}
+
+// sitePath turns a link on the site, a full link or a path under the
+// BaseURL, into the file under the BaseDir
+func sitePath(from string) string {
+	from = strings.TrimPrefix(from, ConfigData.BaseURL)
+	if u, err := url.Parse(ConfigData.BaseURL); err == nil && u.Path != "" {
+		from = strings.TrimPrefix(from, u.Path)
+	}
+	return strings.TrimPrefix(path.Clean("/"+from), "/")
+}
+
+// addRedirect sends the old page, and anything that already redirected to
+// it, to the new link
+func (m *Manifest) addRedirect(fromOutput, fromLink, toLink string) {
+	if fromOutput == "" || fromOutput == "." {
+		return
+	}
+	for from, to := range m.Redirects {
+		if to == fromLink {
+			m.Redirects[from] = toLink
+		}
+	}
+	m.Redirects[fromOutput] = toLink
+}
+
+// redirectMoved adds a redirect for every post whose page has moved since the
+// previous build, keeping the redirects that build had. Posts are matched by
+// source file, or by Id if the file was renamed.
+func (m *Manifest) redirectMoved(previous Manifest) {
+	for from, to := range previous.Redirects {
+		m.Redirects[from] = to
+	}
+	byID := map[string]ManifestEntry{}
+	for _, entry := range m.Entries {
+		if entry.FrontMatter.ID != "" {
+			byID[entry.FrontMatter.ID] = entry
+		}
+	}
+	for key, entry := range previous.Entries {
+		current, ok := m.Entries[key]
+		if !ok && entry.FrontMatter.ID != "" {
+			current, ok = byID[entry.FrontMatter.ID]
+		}
+		if ok && current.Output != entry.Output {
+			m.addRedirect(entry.Output, entry.FrontMatter.Link, current.FrontMatter.Link)
+		}
+	}
+}
+
+// redirects is every old page and where it goes now, both from moved posts
+// and their RedirectFrom, leaving out any page a post has since taken
+func (m Manifest) redirects() map[string]string {
+	redirects := map[string]string{}
+	for from, to := range m.Redirects {
+		redirects[from] = to
+	}
+	for _, entry := range m.Entries {
+		for _, from := range entry.FrontMatter.RedirectFrom {
+			redirects[sitePath(from)] = entry.FrontMatter.Link
+		}
+	}
+	for _, entry := range m.Entries {
+		delete(redirects, entry.Output)
+	}
+	delete(redirects, "")
+	delete(redirects, ".")
+	return redirects
+}
+
+// redirectFormats is the configured redirect formats, or the default
+func redirectFormats() []string {
+	if len(ConfigData.Redirects) == 0 {
+		return defaultRedirectFormats
+	}
+	return ConfigData.Redirects
+}
+
+// redirectFiles is the files writeRedirects writes for the redirects, sorted
+func redirectFiles(redirects map[string]string) []string {
+	files := []string{}
+	if len(redirects) == 0 {
+		return files
+	}
+	for _, format := range redirectFormats() {
+		switch format {
+		case "stub":
+			for from := range redirects {
+				files = append(files, from)
+			}
+		case "htaccess":
+			files = append(files, ".htaccess")
+		case "netlify":
+			files = append(files, "_redirects")
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// writeRedirects writes the redirects into the BaseDir in each of the
+// configured formats, stub pages, .htaccess or _redirects
+func writeRedirects() {
+	redirects := siteManifest.redirects()
+	if len(redirects) == 0 {
+		return
+	}
+	froms := make([]string, 0, len(redirects))
+	for from := range redirects {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	basePath := "/"
+	if u, err := url.Parse(ConfigData.BaseURL); err == nil && u.Path != "" {
+		basePath = u.Path
+	}
+
+	for _, format := range redirectFormats() {
+		var lines strings.Builder
+		for _, from := range froms {
+			to := redirects[from]
+			switch format {
+			case "stub":
+				filename := filepath.Join(ConfigData.BaseDir, from)
+				os.MkdirAll(filepath.Dir(filename), 0755)
+				content := fmt.Sprintf(redirectPageTemplate, html.EscapeString(to))
+				buildReport.add(from, "redirect", os.WriteFile(filename, []byte(content), 0777))
+			case "htaccess":
+				fmt.Fprintf(&lines, "Redirect 301 %s %s\n", path.Join(basePath, from), to)
+			case "netlify":
+				fmt.Fprintf(&lines, "%s %s 301\n", path.Join(basePath, from), to)
+			}
+		}
+		switch format {
+		case "htaccess":
+			buildReport.add(".htaccess", "redirect", os.WriteFile(filepath.Join(ConfigData.BaseDir, ".htaccess"), []byte(lines.String()), 0666))
+		case "netlify":
+			buildReport.add("_redirects", "redirect", os.WriteFile(filepath.Join(ConfigData.BaseDir, "_redirects"), []byte(lines.String()), 0666))
+		case "stub":
+		default:
+			buildReport.add("", "redirect", fmt.Errorf("unknown redirect format %s", format))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddRedirectFollowsChains(t *testing.T) {
+	m := newManifest()
+	m.addRedirect("posts/article/2024/05/one.html", "https://vonexplaino.com/blog/posts/article/2024/05/one.html", "https://vonexplaino.com/blog/posts/article/2024/05/two.html")
+	m.addRedirect("posts/article/2024/05/two.html", "https://vonexplaino.com/blog/posts/article/2024/05/two.html", "https://vonexplaino.com/blog/posts/article/2024/05/three.html")
+	for _, from := range []string{"posts/article/2024/05/one.html", "posts/article/2024/05/two.html"} {
+		if m.Redirects[from] != "https://vonexplaino.com/blog/posts/article/2024/05/three.html" {
+			t.Fatalf("Redirect from %s doesn't go to the latest page %v", from, m.Redirects)
+		}
+	}
+
+	previous := newManifest()
+	previous.Entries["posts/article/old.md"] = ManifestEntry{Output: "posts/article/2024/05/old.html", FrontMatter: FrontMatter{ID: "abc", Link: "old"}}
+	previous.Entries["posts/article/same.md"] = ManifestEntry{Output: "posts/article/2024/05/same.html"}
+	current := newManifest()
+	current.Entries["posts/article/new.md"] = ManifestEntry{Output: "posts/article/2024/05/new.html", FrontMatter: FrontMatter{ID: "abc", Link: "new"}}
+	current.Entries["posts/article/same.md"] = ManifestEntry{Output: "posts/article/2024/05/same.html"}
+	current.redirectMoved(previous)
+	if len(current.Redirects) != 1 || current.Redirects["posts/article/2024/05/old.html"] != "new" {
+		t.Fatalf("Renamed post not matched by Id %v", current.Redirects)
+	}
+}
+
+func TestWriteRedirects(t *testing.T) {
+	keepConfig(t)
+	previousReport, previousManifest := buildReport, siteManifest
+	t.Cleanup(func() { buildReport, siteManifest = previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Redirects = []string{"stub", "htaccess", "netlify"}
+	siteManifest.Redirects["posts/article/2024/05/old.html"] = "https://vonexplaino.com/blog/posts/article/2024/05/new.html"
+	siteManifest.Redirects["posts/article/2024/05/taken.html"] = "https://vonexplaino.com/blog/posts/article/2024/05/new.html"
+	siteManifest.Entries["posts/article/taken.md"] = ManifestEntry{Output: "posts/article/2024/05/taken.html"}
+	siteManifest.Entries["posts/article/new.md"] = ManifestEntry{
+		Output: "posts/article/2024/05/new.html",
+		FrontMatter: FrontMatter{
+			Link:         "https://vonexplaino.com/blog/posts/article/2024/05/new.html",
+			RedirectFrom: []string{"https://vonexplaino.com/blog/posts/older.html", "/blog/posts/oldest.html"},
+		},
+	}
+
+	writeRedirects()
+	if buildReport.failed() {
+		t.Fatalf("Redirects failed %s", buildReport.Summary())
+	}
+	for _, from := range []string{"posts/article/2024/05/old.html", "posts/older.html", "posts/oldest.html"} {
+		content, err := os.ReadFile(filepath.Join(ConfigData.BaseDir, from))
+		if err != nil || !strings.Contains(string(content), `url=https://vonexplaino.com/blog/posts/article/2024/05/new.html`) {
+			t.Fatalf("No redirect stub for %s %s %v", from, content, err)
+		}
+	}
+	htaccess, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, ".htaccess"))
+	if !strings.Contains(string(htaccess), "Redirect 301 /blog/posts/older.html https://vonexplaino.com/blog/posts/article/2024/05/new.html\n") ||
+		strings.Contains(string(htaccess), "taken.html") {
+		t.Fatalf("Wrong .htaccess\n%s", htaccess)
+	}
+	netlify, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "_redirects"))
+	if strings.Count(string(netlify), " 301\n") != 3 {
+		t.Fatalf("Wrong _redirects\n%s", netlify)
+	}
+}
+
+func TestRenamedPostIsRedirected(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest := buildReport, siteManifest
+	t.Cleanup(func() { buildReport, siteManifest = previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/old.md": "---\nTitle: Old name\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Redirects = nil
+	_, postsById := processFileUpdates(GitDiffs{Added: []string{"posts/article/old.md"}}, map[string][]FrontMatter{}, map[string]Item{})
+
+	os.Rename(filepath.Join(ConfigData.RepositoryDir, "posts/article/old.md"), filepath.Join(ConfigData.RepositoryDir, "posts/article/new.md"))
+	os.WriteFile(filepath.Join(ConfigData.RepositoryDir, "posts/article/new.md"), []byte("---\nTitle: New name\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody"), 0666)
+	changes := ProcessGitDiffs("R087\tposts/article/old.md\tposts/article/new.md\n")
+	if len(changes.RenameEdit) != 1 || changes.RenameEdit[0] != "posts/article/new.md" || changes.RenamedFrom["posts/article/new.md"] != "posts/article/old.md" {
+		t.Fatalf("Rename not parsed %v", changes)
+	}
+	tags, _, postsById := getAllChangedTagsAndDeletedFiles(changes, postsById)
+	_, postsById = processFileUpdates(changes, tags, postsById)
+	writeRedirects()
+
+	if len(postsById) != 1 || len(siteManifest.Entries) != 1 {
+		t.Fatalf("Old post still listed %v %v", postsById, siteManifest.Entries)
+	}
+	content, err := os.ReadFile(filepath.Join(ConfigData.BaseDir, "posts/article/2024/05/old-name.html"))
+	if err != nil || !strings.Contains(string(content), "https://vonexplaino.com/blog/posts/article/2024/05/new-name.html") {
+		t.Fatalf("Old page doesn't redirect %s %v", content, err)
+	}
+}
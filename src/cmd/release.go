@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// Builds are made in TempDir, named for when they started
+var releaseFormat = "20060102150405"
+var releaseName = regexp.MustCompile(`^\d{14}$`)
+var defaultKeepBuilds = 5
+
+var ReleaseList bool
+
+// rollbackCmd points the site back at an earlier full regenerate
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [build-id]",
+	Short: "Point the blog at a previous build",
+	Long: `Swaps the BaseDir link to an earlier full regenerate in the TempDir, the one before the current build if no build-id is given.
+
+Changes made by updates since that build was made are not in it.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		current := currentRelease(ConfigData.BaseDir)
+		if ReleaseList {
+			for _, release := range listReleases(ConfigData.TempDir) {
+				if release == current {
+					fmt.Printf("%s (current)\n", release)
+				} else {
+					fmt.Println(release)
+				}
+			}
+			return
+		}
+		target := ""
+		if len(args) > 0 {
+			target = args[0]
+		}
+		release, err := rollbackRelease(ConfigData.TempDir, ConfigData.BaseDir, target)
+		if err != nil {
+			log.Fatalf("Could not roll back %v\n", err)
+		}
+		fmt.Printf("Rolled back from %s to %s\n", current, release)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().BoolVarP(&ReleaseList, "list", "l", false, "List the builds that can be rolled back to")
+}
+
+// listReleases returns the builds in the directory, oldest first
+func listReleases(dir string) []string {
+	releases := []string{}
+	items, _ := os.ReadDir(dir)
+	for _, item := range items {
+		if item.IsDir() && releaseName.MatchString(item.Name()) {
+			releases = append(releases, item.Name())
+		}
+	}
+	sort.Strings(releases)
+	return releases
+}
+
+// currentRelease is the build the blog directory links to, if it's a link
+func currentRelease(blogDir string) string {
+	target, err := os.Readlink(filepath.Clean(blogDir))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// pruneReleases removes all but the newest keep builds, never removing the current one
+func pruneReleases(dir string, keep int, current string) {
+	if keep < 1 {
+		keep = defaultKeepBuilds
+	}
+	releases := listReleases(dir)
+	for i := 0; i < len(releases)-keep; i++ {
+		if releases[i] != current {
+			os.RemoveAll(filepath.Join(dir, releases[i]))
+		}
+	}
+}
+
+// swapSymlink points link at target by renaming a new link over the old one,
+// so there is always a site being served
+func swapSymlink(target, link string) error {
+	link = filepath.Clean(link)
+	next := link + ".next"
+	os.Remove(next)
+	if err := os.Symlink(target, next); err != nil {
+		return err
+	}
+	if err := os.Rename(next, link); err != nil {
+		os.Remove(next)
+		return err
+	}
+	return nil
+}
+
+// rollbackRelease points the blog at the named build, or the one before the
+// current build, returning the build it now points at
+func rollbackRelease(dir, blogDir, release string) (string, error) {
+	releases := listReleases(dir)
+	current := currentRelease(blogDir)
+	if release == "" {
+		for _, r := range releases {
+			if r < current {
+				release = r
+			}
+		}
+		if release == "" {
+			return "", fmt.Errorf("no build before %s in %s", current, dir)
+		}
+	} else if !contains(releases, release) {
+		return "", fmt.Errorf("no build %s in %s", release, dir)
+	}
+	return release, swapSymlink(filepath.Join(dir, release), blogDir)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeReleases(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+	for _, name := range names {
+		os.MkdirAll(filepath.Join(dir, name), 0755)
+	}
+	return dir
+}
+
+func TestPruneReleases(t *testing.T) {
+	dir := makeReleases(t, "20240101000000", "20240102000000", "20240103000000", "20240104000000", "notabuild")
+	pruneReleases(dir, 2, "20240101000000")
+	releases := listReleases(dir)
+	if strings.Join(releases, ",") != "20240101000000,20240103000000,20240104000000" {
+		t.Fatalf("Wrong builds kept %v", releases)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notabuild")); err != nil {
+		t.Fatalf("Removed something that wasn't a build %v", err)
+	}
+}
+
+func TestSwapSymlinkAndRollback(t *testing.T) {
+	dir := makeReleases(t, "20240101000000", "20240102000000", "20240103000000")
+	blogDir := filepath.Join(t.TempDir(), "blog")
+	if err := swapSymlink(filepath.Join(dir, "20240103000000"), blogDir); err != nil {
+		t.Fatalf("Failed to link %v", err)
+	}
+	if err := swapSymlink(filepath.Join(dir, "20240103000000"), blogDir); err != nil {
+		t.Fatalf("Failed to replace the link %v", err)
+	}
+	if currentRelease(blogDir) != "20240103000000" {
+		t.Fatalf("Wrong current build %s", currentRelease(blogDir))
+	}
+
+	release, err := rollbackRelease(dir, blogDir, "")
+	if err != nil || release != "20240102000000" || currentRelease(blogDir) != release {
+		t.Fatalf("Wrong rollback %s %s %v", release, currentRelease(blogDir), err)
+	}
+	release, err = rollbackRelease(dir, blogDir, "20240103000000")
+	if err != nil || currentRelease(blogDir) != "20240103000000" {
+		t.Fatalf("Wrong rollback to a named build %s %v", release, err)
+	}
+	if _, err = rollbackRelease(dir, blogDir, "19990101000000"); err == nil {
+		t.Fatalf("Rolled back to a build that doesn't exist")
+	}
+	swapSymlink(filepath.Join(dir, "20240101000000"), blogDir)
+	if _, err = rollbackRelease(dir, blogDir, ""); err == nil {
+		t.Fatalf("Rolled back past the oldest build")
+	}
+}
+
+func TestPublishRelease(t *testing.T) {
+	keepConfig(t)
+	ConfigData.TempDir = makeReleases(t, "20240101000000", "20240102000000")
+	ConfigData.KeepBuilds = 5
+	blogDir := filepath.Join(t.TempDir(), "blog")
+	swapSymlink(filepath.Join(ConfigData.TempDir, "20240101000000"), blogDir)
+	t.Cleanup(func() { pendingRelease = siteRelease{} })
+	pendingRelease = siteRelease{Dir: filepath.Join(ConfigData.TempDir, "20240102000000"), Link: blogDir, ID: "20240102000000"}
+
+	// Another build being written doesn't publish the full regenerate
+	ConfigData.BaseDir = t.TempDir()
+	if err := publishRelease(); err != nil || currentRelease(blogDir) != "20240101000000" {
+		t.Fatalf("Published while writing another build %s %v", currentRelease(blogDir), err)
+	}
+	ConfigData.BaseDir = pendingRelease.Dir
+	if err := publishRelease(); err != nil || currentRelease(blogDir) != "20240102000000" || ConfigData.BaseDir != blogDir {
+		t.Fatalf("Didn't publish the build %s %s %v", currentRelease(blogDir), ConfigData.BaseDir, err)
+	}
+	if pendingRelease.Dir != "" {
+		t.Fatalf("Build still pending %v", pendingRelease)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var reportFilename = "build-report.json"
+
+// The update exits with this when the site was built but some files failed,
+// so hooks can tell it apart from the update not running at all (1)
+var exitCodeBuildErrors = 3
+
+// BuildError is one file that failed at one stage of the update
+type BuildError struct {
+	File  string `json:"file"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+// BuildReport collects the failures of an update, so a bad post doesn't stop
+// the rest of the site being built
+type BuildReport struct {
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Mode     string       `json:"mode"`
+	Errors   []BuildError `json:"errors"`
+	mutex    sync.Mutex
+}
+
+var buildReport = newBuildReport()
+
+func newBuildReport() *BuildReport {
+	return &BuildReport{Started: time.Now(), Errors: []BuildError{}}
+}
+
+// add records a failure, doing nothing if there wasn't one
+func (r *BuildReport) add(file string, stage string, err error) {
+	if err == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Errors = append(r.Errors, BuildError{File: file, Stage: stage, Error: err.Error()})
+}
+
+func (r *BuildReport) failed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.Errors) > 0
+}
+
+// write saves the report as JSON into the dir
+func (r *BuildReport) write(dir string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Finished = time.Now()
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, reportFilename), content, 0666)
+}
+
+// Summary is the report as lines for the console
+func (r *BuildReport) Summary() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	summary := fmt.Sprintf("%d errors during the update\n", len(r.Errors))
+	for _, e := range r.Errors {
+		summary += fmt.Sprintf("  [%s] %s: %s\n", e.Stage, e.File, e.Error)
+	}
+	return summary
+}
+
+// finishBuild writes the report next to the build, and exits with
+// exitCodeBuildErrors if anything failed
+func finishBuild() {
+	if err := buildReport.write(ConfigData.BaseDir); err != nil {
+		fmt.Printf("Failed to write the build report %v\n", err)
+	}
+	if buildReport.failed() {
+		fmt.Print(buildReport.Summary())
+		os.Exit(exitCodeBuildErrors)
+	}
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildReport(t *testing.T) {
+	report := newBuildReport()
+	report.add("posts/fine.md", "parse", nil)
+	if report.failed() {
+		t.Fatalf("Failed without an error")
+	}
+	report.add("posts/bad.md", "parse", errors.New("bad frontmatter"))
+	if !report.failed() || !strings.Contains(report.Summary(), "[parse] posts/bad.md: bad frontmatter") {
+		t.Fatalf("Bad summary %s", report.Summary())
+	}
+	dir := t.TempDir()
+	if err := report.write(dir); err != nil {
+		t.Fatalf("Failed to write %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, reportFilename))
+	var read BuildReport
+	if err := json.Unmarshal(content, &read); err != nil || len(read.Errors) != 1 || read.Errors[0].Stage != "parse" {
+		t.Fatalf("Bad report %s %v", content, err)
+	}
+}
+
+func TestProcessFileUpdatesContinuesPastBadPosts(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest := buildReport, siteManifest
+	t.Cleanup(func() { buildReport, siteManifest = previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/bad.md":  "---\nTitle: [Bad\n---\nBody",
+		"posts/article/good.md": "---\nTitle: Good\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+
+	tags, postsById := processFileUpdates(
+		GitDiffs{Added: []string{"posts/article/bad.md", "posts/article/good.md"}},
+		map[string][]FrontMatter{},
+		map[string]Item{})
+	if len(tags["code"]) != 1 || len(postsById) != 1 {
+		t.Fatalf("Good post not processed %v %v", tags, postsById)
+	}
+	if len(buildReport.Errors) != 1 || buildReport.Errors[0].File != "posts/article/bad.md" || buildReport.Errors[0].Stage != "parse" {
+		t.Fatalf("Bad post not reported %v", buildReport.Errors)
+	}
+	if _, ok := siteManifest.Sources["posts/article/bad.md"]; ok {
+		t.Fatalf("Bad post recorded as built")
+	}
+}
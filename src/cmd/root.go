@@ -68,6 +68,18 @@ type Syndics struct {
 	Mastodon Mastodon
 	Bluesky  Bluesky
 }
+type Podcast struct {
+	Title       string
+	Description string
+	Author      string
+	Email       string
+	Image       string
+	Category    string
+	Explicit    bool
+}
+type WebSub struct {
+	Hub string
+}
 type Moods struct {
 	Filename string
 	Token    string
@@ -76,6 +88,13 @@ type ConfigDataStruct struct {
 	BaseDir       string
 	BaseURL       string
 	TempDir       string
+	KeepBuilds    int
+	Redirects     []string
+	FullContent   bool
+	Podcast       Podcast
+	Feeds         map[string]FeedTemplate
+	Blogroll      []BlogrollEntry
+	WebSub        WebSub
 	RepositoryDir string
 	PerPage       int
 	TemplateDir   string
@@ -158,12 +177,36 @@ func initConfig() {
 		ConfigData.Thumbnails.Extension = viper.GetString("thumbnails.extension")
 		ConfigData.Thumbnails.Type = viper.GetString("thumbnails.type")
 		ConfigData.TempDir = viper.GetString("tempDir")
+		ConfigData.KeepBuilds = viper.GetInt("keepBuilds")
+		ConfigData.Redirects = viper.GetStringSlice("redirects")
+		ConfigData.FullContent = viper.GetBool("fullContentFeeds")
 		// Syndications
 		ConfigData.Syndication.Mastodon.URL = viper.GetString("syndication.mastodon.url")
 		ConfigData.Syndication.Mastodon.Token = viper.GetString("syndication.mastodon.token")
 		ConfigData.Syndication.Bluesky.URL = viper.GetString("syndication.bluesky.url")
 		ConfigData.Syndication.Bluesky.Userid = viper.GetString("syndication.bluesky.userid")
 		ConfigData.Syndication.Bluesky.Password = viper.GetString("syndication.bluesky.password")
+		// Feeds
+		ConfigData.Feeds = map[string]FeedTemplate{}
+		for _, kind := range feedKinds {
+			ConfigData.Feeds[kind] = FeedTemplate{
+				Title:       viper.GetString("feeds." + kind + ".title"),
+				Description: viper.GetString("feeds." + kind + ".description"),
+				Link:        viper.GetString("feeds." + kind + ".link"),
+			}
+		}
+		// Podcast
+		ConfigData.Podcast.Title = viper.GetString("podcast.title")
+		ConfigData.Podcast.Description = viper.GetString("podcast.description")
+		ConfigData.Podcast.Author = viper.GetString("podcast.author")
+		ConfigData.Podcast.Email = viper.GetString("podcast.email")
+		ConfigData.Podcast.Image = viper.GetString("podcast.image")
+		ConfigData.Podcast.Category = viper.GetString("podcast.category")
+		ConfigData.Podcast.Explicit = viper.GetBool("podcast.explicit")
+		// WebSub
+		ConfigData.WebSub.Hub = viper.GetString("websub.hub")
+		// Blogroll
+		viper.UnmarshalKey("blogroll", &ConfigData.Blogroll)
 		// MISC
 		ConfigData.TagSnippets = viper.GetStringSlice("tagSnippets")
 		// MOODS
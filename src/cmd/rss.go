@@ -1,24 +1,39 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
 type Item struct {
-	XMLName         xml.Name  `xml:"item"`
-	Title           string    `xml:"title"`
-	Description     string    `xml:"description"`
-	PublicationDate string    `xml:"pubDate"`
-	PubDateAsDate   time.Time `xml:"-"`
-	GUID            string    `xml:"guid"`
-	Tags            []string  `xml:"subject"`
+	XMLName         xml.Name    `xml:"item"`
+	Title           string      `xml:"title"`
+	Description     string      `xml:"description"`
+	PublicationDate string      `xml:"pubDate"`
+	PubDateAsDate   time.Time   `xml:"-"`
+	GUID            string      `xml:"guid"`
+	Tags            []string    `xml:"subject"`
+	Author          string      `xml:"author,omitempty"`
+	Categories      []string    `xml:"category"`
+	Comments        string      `xml:"comments,omitempty"`
+	Enclosures      []Enclosure `xml:"enclosure"`
+	ContentEncoded  string      `xml:"encoded,omitempty"`
+}
+
+type Enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
 }
 type AtomLink struct {
 	XMLName xml.Name `xml:"atom:link"`
@@ -39,8 +54,9 @@ type Channel struct {
 	Generator     string   `xml:"generator"`
 	WebMaster     string   `xml:"webMaster"`
 	TimeToLive    string   `xml:"ttl"`
-	AtomLink      AtomLink
-	Items         []Item `xml:"item"`
+	AtomLinks     []AtomLink
+	Archive       *struct{} `xml:"fh:archive,omitempty"`
+	Items         []Item    `xml:"item"`
 }
 
 type RSS struct {
@@ -49,6 +65,84 @@ type RSS struct {
 	Channel Channel  `xml:"channel"`
 	XmlnsA  string   `xml:"xmlns:atom,attr"`
 	XmlnsB  string   `xml:"xmlns:rssTags,attr"`
+	XmlnsC  string   `xml:"xmlns:content,attr,omitempty"`
+	XmlnsD  string   `xml:"xmlns:fh,attr,omitempty"`
+}
+
+// How many items go in the latest feeds, and in the tag and type feeds
+var latestFeedLimit = 10
+var listFeedLimit = 20
+
+// FeedTemplate is how a kind of feed describes itself, as templates of FeedVars
+type FeedTemplate struct {
+	Title       string
+	Description string
+	Link        string
+}
+
+// FeedVars is what a FeedTemplate can use
+type FeedVars struct {
+	Site        string
+	Description string
+	BaseURL     string
+	Tag         string
+	Type        string
+	Date        string
+	Slug        string
+}
+
+// The kinds of feed, and how they describe themselves unless the config says otherwise
+var feedKinds = []string{"all", "latest", "tag", "type", "date"}
+var defaultFeedTemplates = map[string]FeedTemplate{
+	"all":    {Title: "{{.Site}}", Description: "{{.Description}}", Link: "{{.BaseURL}}"},
+	"latest": {Title: "{{.Site}}", Description: "{{.Description}}", Link: "{{.BaseURL}}"},
+	"tag":    {Title: "{{.Site}} Feed Tagged {{.Tag}}", Description: "A feed of posts containing the tag '{{.Tag}}'", Link: "{{.BaseURL}}tag/{{.Slug}}-1.html"},
+	"type":   {Title: "{{.Site}}: {{.Type}}", Description: "A feed of the {{.Type}} posts", Link: "{{.BaseURL}}type/{{.Slug}}-1.html"},
+	"date":   {Title: "{{.Site}}: {{.Date}}", Description: "A feed of the posts from {{.Date}}", Link: "{{.BaseURL}}{{.Slug}}/"},
+}
+
+// feedChannel is the title, description and link of a kind of feed, from its
+// templates in the config
+func feedChannel(kind string, vars FeedVars) (Channel, error) {
+	vars.Site = ConfigData.Metadata.Title
+	vars.Description = ConfigData.Metadata.Description
+	vars.BaseURL = ConfigData.BaseURL
+	defaults := defaultFeedTemplates[kind]
+	configured := ConfigData.Feeds[kind]
+	var channel Channel
+	var err error
+	for _, field := range []struct {
+		value      *string
+		configured string
+		fallback   string
+	}{
+		{&channel.Title, configured.Title, defaults.Title},
+		{&channel.Description, configured.Description, defaults.Description},
+		{&channel.Link, configured.Link, defaults.Link},
+	} {
+		text := field.configured
+		if text == "" {
+			text = field.fallback
+		}
+		value, e := executeFeedTemplate(text, vars)
+		if e != nil {
+			// Keep the feed going with the default
+			err = fmt.Errorf("bad %s feed template %s [%v]", kind, text, e)
+			value, _ = executeFeedTemplate(field.fallback, vars)
+		}
+		*field.value = value
+	}
+	return channel, err
+}
+
+func executeFeedTemplate(text string, vars FeedVars) (string, error) {
+	t, err := template.New("feed").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, vars)
+	return buf.String(), err
 }
 
 func ReadRSS(filename string) (RSS, error) {
@@ -69,6 +163,7 @@ func ReadRSS(filename string) (RSS, error) {
 	byteValue, _ := io.ReadAll(xmlFile)
 	byteValue = []byte(strings.ReplaceAll(string(byteValue), "rssTags:", ""))
 	byteValue = []byte(strings.ReplaceAll(string(byteValue), "xmlns:", ""))
+	byteValue = []byte(strings.NewReplacer("<content:encoded>", "<encoded>", "</content:encoded>", "</encoded>").Replace(string(byteValue)))
 
 	err = xml.Unmarshal(byteValue, &feed)
 	if err == nil {
@@ -89,19 +184,36 @@ func WriteRSS(feed RSS, filename string, limit int) error {
 	feed.Version = "2.0"
 	feed.XmlnsA = "http://www.w3.org/2005/Atom"
 	feed.XmlnsB = "http://purl.org/dc/elements/1.1/"
-	feed.Channel.Title = ConfigData.Metadata.Title
+	feed.XmlnsC = ""
+	for _, item := range feed.Channel.Items {
+		if item.ContentEncoded != "" {
+			feed.XmlnsC = "http://purl.org/rss/1.0/modules/content/"
+			break
+		}
+	}
+	if feed.Channel.Title == "" {
+		feed.Channel.Title = ConfigData.Metadata.Title
+		feed.Channel.Description = ConfigData.Metadata.Description
+	}
+	if feed.Channel.Link == "" {
+		feed.Channel.Link = ConfigData.BaseURL
+	}
 	feed.Channel.Language = ConfigData.Metadata.Language
-	feed.Channel.Link = ConfigData.BaseURL
-	feed.Channel.Description = ConfigData.Metadata.Description
 	feed.Channel.LastBuildDate = time.Now().Format(time.RFC1123Z)
 	feed.Channel.TimeToLive = strconv.Itoa(ConfigData.Metadata.Ttl)
 	feed.Channel.WebMaster = ConfigData.Metadata.Webmaster
 	feed.Channel.Generator = "Ridiculous Go Homebrew"
 	feed.Channel.Copyright = "Creative Commons 3.0 with Attribution"
-	feed.Channel.AtomLink = AtomLink{
-		Href: "https://vonexplaino.com/blog/rss.xml",
+	selfLink, _ := url.JoinPath(ConfigData.BaseURL, filename)
+	feed.Channel.AtomLinks = append([]AtomLink{{
+		Href: selfLink,
 		Rel:  "self",
 		Type: "application/rss+xml",
+	}}, feed.Channel.AtomLinks...)
+	if feed.Channel.Archive != nil {
+		feed.XmlnsD = "http://purl.org/syndication/history/1.0"
+	} else {
+		feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, hubLinks()...)
 	}
 	// Ensure sorted in reverse date order
 	sort.SliceStable(feed.Channel.Items, func(p, q int) bool {
@@ -113,16 +225,62 @@ func WriteRSS(feed RSS, filename string, limit int) error {
 	}
 	byteValue, _ := xml.MarshalIndent(feed, "", "    ")
 	byteValue = []byte(strings.ReplaceAll(string(byteValue), "subject>", "rssTags:subject>"))
+	byteValue = []byte(strings.NewReplacer("<encoded>", "<content:encoded>", "</encoded>", "</content:encoded>").Replace(string(byteValue)))
 
-	err := os.WriteFile(filepath.Join(ConfigData.BaseDir, filename), append([]byte("<?xml version=\"1.0\"?>\n"), byteValue...), 0777)
-	return err
+	// Archive pages never change, so there's nothing to tell the hub
+	return writeFeed(filename, append([]byte("<?xml version=\"1.0\"?>\n"), byteValue...), feed.Channel.Archive == nil)
 }
 
-func PostToItem(frontmatter FrontMatter) Item {
-	if len(frontmatter.FeatureImage) > 0 && frontmatter.FeatureImage[0:1] == "/" {
-		frontmatter.FeatureImage = ConfigData.BaseURL[0:len(ConfigData.BaseURL)-6] + frontmatter.FeatureImage
+// archiveFilename is the RFC 5005 archive page of a feed, 1 being the oldest
+func archiveFilename(filename string, page int) string {
+	return fmt.Sprintf("archive/%s-%d.xml", strings.TrimSuffix(strings.TrimPrefix(filename, "/"), ".xml"), page)
+}
+
+// WriteRSSArchive writes the newest limit items as the feed, and every item
+// into archive pages of limit items (RFC 5005) linked from it. Only full pages
+// are archived, so an archive page never changes once it's written.
+func WriteRSSArchive(feed RSS, filename string, limit int) error {
+	items := append([]Item{}, feed.Channel.Items...)
+	sort.SliceStable(items, func(p, q int) bool {
+		return items[p].PubDateAsDate.Before(items[q].PubDateAsDate)
+	})
+	pages := 0
+	if limit > 0 {
+		pages = len(items) / limit
+	}
+	currentLink, _ := url.JoinPath(ConfigData.BaseURL, filename)
+	archiveLink := func(page int) string {
+		link, _ := url.JoinPath(ConfigData.BaseURL, archiveFilename(filename, page))
+		return link
+	}
+	if pages > 0 {
+		os.MkdirAll(filepath.Dir(filepath.Join(ConfigData.BaseDir, archiveFilename(filename, 1))), 0755)
+	}
+	for page := 1; page <= pages; page++ {
+		archive := feed
+		archive.Channel.Items = items[(page-1)*limit : page*limit]
+		archive.Channel.Archive = &struct{}{}
+		archive.Channel.AtomLinks = []AtomLink{{Href: currentLink, Rel: "current", Type: "application/rss+xml"}}
+		if page > 1 {
+			archive.Channel.AtomLinks = append(archive.Channel.AtomLinks, AtomLink{Href: archiveLink(page - 1), Rel: "prev-archive", Type: "application/rss+xml"})
+		}
+		if page < pages {
+			archive.Channel.AtomLinks = append(archive.Channel.AtomLinks, AtomLink{Href: archiveLink(page + 1), Rel: "next-archive", Type: "application/rss+xml"})
+		}
+		if err := WriteRSS(archive, archiveFilename(filename, page), -1); err != nil {
+			return err
+		}
+	}
+	// Fewer items than before, so drop the pages past the end
+	removeNumberedFiles(strings.TrimSuffix(archiveFilename(filename, 0), "-0.xml"), ".xml", pages)
+	if pages > 0 {
+		feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, AtomLink{Href: archiveLink(pages), Rel: "prev-archive", Type: "application/rss+xml"})
 	}
-	return Item{
+	return WriteRSS(feed, filename, limit)
+}
+
+func PostToItem(frontmatter FrontMatter) Item {
+	item := Item{
 		XMLName:         xml.Name{Space: "", Local: "Item"},
 		Title:           frontmatter.Title,
 		Description:     frontmatter.Synopsis,
@@ -130,7 +288,76 @@ func PostToItem(frontmatter FrontMatter) Item {
 		PubDateAsDate:   frontmatter.CreatedDate,
 		GUID:            frontmatter.Link,
 		Tags:            frontmatter.Tags,
+		Author:          rssAuthor(frontmatter.Author),
+		Categories:      frontmatter.Tags,
+	}
+	// Responses to the post are on its crossposts, once they've been made
+	for _, link := range []string{frontmatter.SyndicationLinks.Mastodon, frontmatter.SyndicationLinks.Bluesky} {
+		if isAbsoluteURL(link) {
+			item.Comments = link
+			break
+		}
+	}
+	if ConfigData.FullContent {
+		item.ContentEncoded = frontmatter.Content
+	}
+	for _, media := range append([]string{frontmatter.FeatureImage}, frontmatter.AttachedMedia...) {
+		if enclosure, ok := mediaEnclosure(media); ok {
+			item.Enclosures = append(item.Enclosures, enclosure)
+		}
+	}
+	return item
+}
+
+// rssAuthor is the author as RSS wants it, an email with the name after it
+func rssAuthor(author string) string {
+	if author == "" || strings.Contains(author, "@") {
+		return author
+	}
+	if matches := webmasterFormat.FindStringSubmatch(ConfigData.Metadata.Webmaster); matches != nil {
+		return matches[1] + " (" + author + ")"
+	}
+	return ""
+}
+
+// mediaEnclosure describes a file from the media directory of the
+// repository, as linked from a post
+func mediaEnclosure(link string) (Enclosure, bool) {
+	filename, fileType, ok := mediaFile(link)
+	if !ok {
+		return Enclosure{}, false
+	}
+	info, _ := os.Stat(filename)
+	return Enclosure{URL: absoluteLink(link), Length: info.Size(), Type: fileType}, true
+}
+
+// mediaFile is the repository file of a link to the site's media, and its
+// MIME type, false if it isn't there
+func mediaFile(link string) (string, string, bool) {
+	if link == "" {
+		return "", "", false
+	}
+	link = absoluteLink(link)
+	if !strings.HasPrefix(link, ConfigData.BaseURL) {
+		return "", "", false
+	}
+	unescaped, err := url.PathUnescape(sitePath(link))
+	if err != nil {
+		return "", "", false
+	}
+	filename := filepath.Join(ConfigData.RepositoryDir, unescaped)
+	info, err := os.Stat(filename)
+	if err != nil || info.IsDir() {
+		return "", "", false
+	}
+	fileType, err := GetFileType(filename)
+	if err != nil {
+		return "", "", false
+	}
+	if filepath.Ext(filename) == ".svg" {
+		fileType = "image/svg+xml"
 	}
+	return filename, fileType, true
 }
 
 func ItemToPost(item Item) FrontMatter {
@@ -5,7 +5,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	testdataloader "github.com/peteole/testdata-loader"
 )
@@ -51,6 +54,8 @@ func TestReadWriteRSS(t *testing.T) {
 
 	f1, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, `rss1.xml`))
 	f2, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, `rss1_out.xml`))
+	// Each feed links to itself
+	f1 = []byte(strings.Replace(string(f1), `https://vonexplaino.com/blog/rss.xml`, `https://vonexplaino.com/blog/rss1_out.xml`, 1))
 
 	rep := regexp.MustCompile(`\n\s*`)
 
@@ -82,3 +87,134 @@ func TestSortRSS(t *testing.T) {
 		t.Fatalf(`Did not sort the right way %s`, mek.Channel.Items[0].Title)
 	}
 }
+
+func TestPostToItemFullContent(t *testing.T) {
+	keepConfig(t)
+	png := "\x89PNG\r\n\x1a\n0000"
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"media/2024/05/cover.png": png,
+		"media/2024/05/talk.pdf":  "%PDF-1.4 talk",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = `https://vonexplaino.com/blog/`
+	ConfigData.Metadata.Webmaster = `professor@vonexplaino.com (Colin Morris)`
+	ConfigData.FullContent = true
+	post := FrontMatter{
+		Title:            "Talk",
+		Link:             "https://vonexplaino.com/blog/posts/article/2024/05/talk.html",
+		Tags:             []string{"Code"},
+		Author:           "Colin Morris",
+		Content:          "<p>The talk</p>",
+		FeatureImage:     "/blog/media/2024/05/cover.png",
+		AttachedMedia:    []string{"https://vonexplaino.com/blog/media/2024/05/talk.pdf", "/blog/media/missing.mp3", "https://example.com/elsewhere.png"},
+		SyndicationLinks: SyndicationLinksS{Mastodon: "https://mastodon.social/@vonexplaino/1"},
+	}
+
+	item := PostToItem(post)
+	if len(item.Enclosures) != 2 || item.Enclosures[0].Type != "image/png" || item.Enclosures[0].Length != int64(len(png)) ||
+		item.Enclosures[0].URL != "https://vonexplaino.com/blog/media/2024/05/cover.png" || item.Enclosures[1].Type != "application/pdf" {
+		t.Fatalf("Wrong enclosures %v", item.Enclosures)
+	}
+	if item.Author != "professor@vonexplaino.com (Colin Morris)" || item.Comments != post.SyndicationLinks.Mastodon || item.Categories[0] != "Code" {
+		t.Fatalf("Wrong author, comments or category %v", item)
+	}
+	// Still waiting to be crossposted to one, so the comments are on the other
+	waiting := post
+	waiting.SyndicationLinks = SyndicationLinksS{Mastodon: "XPOST", Bluesky: "https://bsky.app/profile/vonexplaino.com/post/1"}
+	if comments := PostToItem(waiting).Comments; comments != waiting.SyndicationLinks.Bluesky {
+		t.Fatalf("Comments on a crosspost that isn't made yet %s", comments)
+	}
+	waiting.SyndicationLinks.Bluesky = "XPOST"
+	if comments := PostToItem(waiting).Comments; comments != "" {
+		t.Fatalf("Comments on a crosspost that isn't made yet %s", comments)
+	}
+	if err := WriteRSS(RSS{Channel: Channel{Items: []Item{item}}}, "all-rss.xml", -1); err != nil {
+		t.Fatalf("Failed to write the feed %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "all-rss.xml"))
+	if !regexp.MustCompile(`xmlns:content="http://purl.org/rss/1.0/modules/content/"`).Match(content) ||
+		!regexp.MustCompile(`<content:encoded>&lt;p&gt;The talk&lt;/p&gt;</content:encoded>`).Match(content) {
+		t.Fatalf("No full content in the feed\n%s", content)
+	}
+	// And it survives being read back and written again
+	feed, err := ReadRSS(filepath.Join(ConfigData.BaseDir, "all-rss.xml"))
+	if err != nil || len(feed.Channel.Items) != 1 || feed.Channel.Items[0].ContentEncoded != "<p>The talk</p>" {
+		t.Fatalf("Full content not read back %v %v", feed.Channel.Items, err)
+	}
+	if err := WriteRSS(feed, "all-rss.xml", -1); err != nil {
+		t.Fatalf("Failed to write the feed again %v", err)
+	}
+	rewritten, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "all-rss.xml"))
+	if !regexp.MustCompile(`<content:encoded>&lt;p&gt;The talk&lt;/p&gt;</content:encoded>`).Match(rewritten) {
+		t.Fatalf("Full content lost rewriting the feed\n%s", rewritten)
+	}
+
+	ConfigData.FullContent = false
+	if PostToItem(post).ContentEncoded != "" {
+		t.Fatalf("Full content when it's turned off")
+	}
+}
+
+func TestFeedChannel(t *testing.T) {
+	keepConfig(t)
+	ConfigData.BaseURL = `https://vonexplaino.com/blog/`
+	ConfigData.Metadata.Title = `Professor von Explaino`
+	ConfigData.Feeds = map[string]FeedTemplate{"tag": {Title: "{{.Site}} on {{.Tag}}"}, "type": {Title: "{{.Broken"}}
+	channel, err := feedChannel("tag", FeedVars{Tag: "Code", Slug: "code"})
+	if err != nil || channel.Title != "Professor von Explaino on Code" || channel.Description != "A feed of posts containing the tag 'Code'" ||
+		channel.Link != "https://vonexplaino.com/blog/tag/code-1.html" {
+		t.Fatalf("Wrong tag channel %v %v", channel, err)
+	}
+	channel, err = feedChannel("type", FeedVars{Type: "review", Slug: "review"})
+	if err == nil || channel.Title != "Professor von Explaino: review" {
+		t.Fatalf("Bad template not reported or defaulted %v %v", channel, err)
+	}
+}
+
+func TestWriteRSSArchive(t *testing.T) {
+	keepConfig(t)
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = `https://vonexplaino.com/blog/`
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "tag"), 0755)
+	feed := RSS{Channel: Channel{Title: "Tagged Code"}}
+	start, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	for i := 0; i < 7; i++ {
+		feed.Channel.Items = append(feed.Channel.Items, PostToItem(FrontMatter{
+			Title:       "Post " + strconv.Itoa(i),
+			Link:        "https://vonexplaino.com/blog/posts/article/2024/05/post-" + strconv.Itoa(i) + ".html",
+			CreatedDate: start.AddDate(0, 0, i),
+		}))
+	}
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "archive/tag"), 0755)
+	os.WriteFile(filepath.Join(ConfigData.BaseDir, "archive/tag/code-4.xml"), []byte("stale"), 0666)
+	if err := WriteRSSArchive(feed, "tag/code.xml", 3); err != nil {
+		t.Fatalf("Failed to write the archive %v", err)
+	}
+
+	current, _ := ReadRSS(filepath.Join(ConfigData.BaseDir, "tag/code.xml"))
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "tag/code.xml"))
+	if len(current.Channel.Items) != 3 || current.Channel.Title != "Tagged Code" ||
+		!strings.Contains(string(content), `<atom:link href="https://vonexplaino.com/blog/tag/code.xml" rel="self"`) ||
+		!strings.Contains(string(content), `<atom:link href="https://vonexplaino.com/blog/archive/tag/code-2.xml" rel="prev-archive"`) {
+		t.Fatalf("Wrong current feed\n%s", content)
+	}
+	first, _ := ReadRSS(filepath.Join(ConfigData.BaseDir, "archive/tag/code-1.xml"))
+	content, _ = os.ReadFile(filepath.Join(ConfigData.BaseDir, "archive/tag/code-1.xml"))
+	if len(first.Channel.Items) != 3 || first.Channel.Items[2].Title != "Post 0" ||
+		!strings.Contains(string(content), `xmlns:fh="http://purl.org/syndication/history/1.0"`) ||
+		!strings.Contains(string(content), `<fh:archive></fh:archive>`) ||
+		!strings.Contains(string(content), `<atom:link href="https://vonexplaino.com/blog/tag/code.xml" rel="current"`) ||
+		!strings.Contains(string(content), `<atom:link href="https://vonexplaino.com/blog/archive/tag/code-2.xml" rel="next-archive"`) ||
+		strings.Contains(string(content), `prev-archive`) {
+		t.Fatalf("Wrong first archive page\n%s", content)
+	}
+	second, _ := ReadRSS(filepath.Join(ConfigData.BaseDir, "archive/tag/code-2.xml"))
+	if len(second.Channel.Items) != 3 || second.Channel.Items[0].Title != "Post 5" {
+		t.Fatalf("Wrong second archive page %v", second.Channel.Items)
+	}
+	for _, page := range []string{"archive/tag/code-3.xml", "archive/tag/code-4.xml"} {
+		if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, page)); err == nil {
+			t.Fatalf("Archive page %s shouldn't be there", page)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type ServeOptionsS struct {
+	Address  string
+	Output   string
+	Interval time.Duration
+}
+
+var ServeOptions ServeOptionsS
+
+// previewSite is the in-memory state of a preview build, so a changed
+// file only needs itself, its tags and the index rebuilt. The posts
+// themselves are kept in the siteManifest.
+type previewSite struct {
+	postsById map[string]Item
+	files     map[string]time.Time
+	templates map[string]time.Time
+}
+
+// serveCmd builds the repository into a scratch directory and serves it
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Preview the blog locally",
+	Long: `Builds the repository into a scratch directory, serves it over HTTP and rebuilds pages as their markdown, media or templates change.
+
+Never pulls from git, crossposts, or touches the live site.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		NoCrosspost = true
+		if ServeOptions.Output == "" {
+			ServeOptions.Output = filepath.Join(os.TempDir(), "vonblog-preview")
+		}
+		ConfigData.BaseDir = ServeOptions.Output
+		basePath := "/"
+		if u, err := url.Parse(ConfigData.BaseURL); err == nil && u.Path != "" {
+			basePath = u.Path
+		}
+		ConfigData.BaseURL = "http://" + ServeOptions.Address + basePath
+		SetupTemplate()
+
+		site := &previewSite{}
+		if err := site.build(); err != nil {
+			fmt.Printf("Built the preview with errors\n%v", err)
+		}
+		go site.watch(ServeOptions.Interval)
+
+		fmt.Printf("\nServing %s on %s\n", ConfigData.BaseDir, ConfigData.BaseURL)
+		mux := http.NewServeMux()
+		mux.Handle(basePath, http.StripPrefix(strings.TrimSuffix(basePath, "/"), http.FileServer(http.Dir(ConfigData.BaseDir))))
+		log.Fatal(http.ListenAndServe(ServeOptions.Address, mux))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVarP(&ServeOptions.Address, "address", "a", "localhost:8080", "Address to serve the preview on")
+	serveCmd.Flags().StringVarP(&ServeOptions.Output, "output", "o", "", "Scratch directory to build into (default: vonblog-preview in the system temp dir)")
+	serveCmd.Flags().IntVarP(&Jobs, "jobs", "", runtime.NumCPU(), "How many posts to render at the same time")
+	serveCmd.Flags().DurationVarP(&ServeOptions.Interval, "interval", "i", time.Second, "How often to check for changed files")
+}
+
+// build does a full render of the repository into the scratch directory
+func (site *previewSite) build() error {
+	for _, d := range []string{"tag", "media", "posts"} {
+		if err := os.MkdirAll(filepath.Join(ConfigData.BaseDir, d), 0755); err != nil {
+			return err
+		}
+	}
+	siteManifest = newManifest()
+	site.postsById = map[string]Item{}
+	site.files = snapshotFiles(ConfigData.RepositoryDir, []string{"posts", "media"})
+	site.templates = snapshotFiles(SetupTemplate(), []string{""})
+	changed := make([]string, 0, len(site.files))
+	for filename := range site.files {
+		changed = append(changed, filename)
+	}
+	sort.Strings(changed)
+	return site.rebuild(changed, []string{})
+}
+
+// watch polls the repository and templates, rebuilding whatever changed
+func (site *previewSite) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		templates := snapshotFiles(SetupTemplate(), []string{""})
+		changedTemplates, deletedTemplates := diffSnapshots(site.templates, templates)
+		site.templates = templates
+		if len(changedTemplates)+len(deletedTemplates) > 0 {
+			PrintIfNotSilent(fmt.Sprintf("\nTemplates changed %v, rebuilding everything\n", append(changedTemplates, deletedTemplates...)))
+			if err := reloadTemplates(); err != nil {
+				fmt.Printf("%v\n", err)
+				continue
+			}
+			if err := site.build(); err != nil {
+				fmt.Printf("Failed to rebuild preview %v\n", err)
+			}
+			continue
+		}
+		files := snapshotFiles(ConfigData.RepositoryDir, []string{"posts", "media"})
+		changed, deleted := diffSnapshots(site.files, files)
+		site.files = files
+		if len(changed)+len(deleted) > 0 {
+			PrintIfNotSilent(fmt.Sprintf("\nChanged %v, deleted %v\n", changed, deleted))
+			if err := site.rebuild(changed, deleted); err != nil {
+				fmt.Printf("Failed to rebuild preview %v\n", err)
+			}
+		}
+	}
+}
+
+// rebuild renders the changed files, removes the deleted ones, and then
+// regenerates the tag pages they touch along with the index
+func (site *previewSite) rebuild(changed []string, deleted []string) error {
+	buildReport = newBuildReport()
+	buildReport.Mode = "preview"
+	// Scheduled posts appear once they're due
+	DateOfExecution = time.Now()
+	filesToDelete := map[string]struct{}{}
+	tags := map[string][]FrontMatter{}
+
+	for _, filename := range deleted {
+		if entry, ok := siteManifest.remove(filename); ok {
+			touchTags(tags, entry.Tags)
+			delete(site.postsById, entry.FrontMatter.Link)
+			filesToDelete[entry.Output] = struct{}{}
+		} else {
+			filesToDelete[filename] = struct{}{}
+		}
+	}
+	rendered := renderMDFiles(changed, Jobs)
+	for i, filename := range changed {
+		if filepath.Ext(filename) == ".md" {
+			writeMDFile(&tags, &site.postsById, filename, rendered[i])
+		} else if strings.HasPrefix(filename, "media") {
+			buildReport.add(filename, "media", processMediaFile(filename))
+		}
+	}
+	deleteAndRegenerate(RSS{}, tags, site.postsById, filesToDelete, GitDiffs{})
+
+	if buildReport.failed() {
+		return errors.New(buildReport.Summary())
+	}
+	return nil
+}
+
+// reloadTemplates re-reads the template directory, keeping the previous
+// templates if the new ones don't parse
+func reloadTemplates() (err error) {
+	previous := templ
+	defer func() {
+		if r := recover(); r != nil {
+			templ = previous
+			err = fmt.Errorf("failed to reload templates %v", r)
+		}
+	}()
+	templ = nil
+	SetupTemplate()
+	return nil
+}
+
+// snapshotFiles lists the files under each of the subdirectories of root,
+// relative to root, with their modification times
+func snapshotFiles(root string, subdirs []string) map[string]time.Time {
+	files := map[string]time.Time{}
+	for _, subdir := range subdirs {
+		filepath.Walk(filepath.Join(root, subdir), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			relative, err := filepath.Rel(root, path)
+			if err == nil {
+				files[filepath.ToSlash(relative)] = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// diffSnapshots returns the files that are new or modified in current, and
+// the files that are no longer there, both sorted
+func diffSnapshots(previous, current map[string]time.Time) ([]string, []string) {
+	changed := []string{}
+	deleted := []string{}
+	for filename, modified := range current {
+		if was, ok := previous[filename]; !ok || !was.Equal(modified) {
+			changed = append(changed, filename)
+		}
+	}
+	for filename := range previous {
+		if _, ok := current[filename]; !ok {
+			deleted = append(deleted, filename)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return changed, deleted
+}
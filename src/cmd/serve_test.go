@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	testdataloader "github.com/peteole/testdata-loader"
+)
+
+func TestSnapshotFiles(t *testing.T) {
+	files := snapshotFiles(filepath.Clean(testdataloader.GetBasePath()+`/../features/tests/gits/`), []string{"posts", "media"})
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 files, got %d %v", len(files), files)
+	}
+	if _, ok := files["posts/testfile1.md"]; !ok {
+		t.Fatalf("Didn't find posts/testfile1.md in %v", files)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	then := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := then.Add(time.Minute)
+	previous := map[string]time.Time{
+		"posts/same.md":    then,
+		"posts/changed.md": then,
+		"media/gone.png":   then,
+	}
+	current := map[string]time.Time{
+		"posts/same.md":    then,
+		"posts/changed.md": now,
+		"posts/new.md":     now,
+	}
+	changed, deleted := diffSnapshots(previous, current)
+	if len(changed) != 2 || changed[0] != "posts/changed.md" || changed[1] != "posts/new.md" {
+		t.Fatalf("Wrong changed files %v", changed)
+	}
+	if len(deleted) != 1 || deleted[0] != "media/gone.png" {
+		t.Fatalf("Wrong deleted files %v", deleted)
+	}
+	changed, deleted = diffSnapshots(current, current)
+	if len(changed) != 0 || len(deleted) != 0 {
+		t.Fatalf("Found changes when there were none %v %v", changed, deleted)
+	}
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Syndicator is somewhere posts are crossposted to. Posts ask for a
+// crosspost by setting the target's Syndication link to XPOST, and the link
+// to the crosspost replaces it.
+type Syndicator interface {
+	// Name is the target's key under Syndication in the post
+	Name() string
+	// Wants is true if the post asks to be crossposted here
+	Wants(frontmatter FrontMatter) bool
+	// Format turns the post into the message to send
+	Format(frontmatter *FrontMatter) SyndicationMessage
+	// Post sends the message, returning the link to the crosspost
+	Post(message SyndicationMessage) (string, error)
+	// RecordLink puts the crosspost link into the post and its source file
+	RecordLink(filename string, frontmatter *FrontMatter, link string) error
+}
+
+// SyndicationMessage is a post as it's sent to a target
+type SyndicationMessage struct {
+	Text      string
+	Facets    []facetStruct
+	CreatedAt time.Time
+	Media     []SyndicationMedia
+	Card      *SyndicationCard
+	Spoiler   string
+	Language  string
+}
+
+// SyndicationCard is a preview of the post, for targets that show links as cards
+type SyndicationCard struct {
+	Link        string
+	Title       string
+	Description string
+	Image       string
+}
+
+// SyndicationMedia is an image or other media of the post, to upload
+// alongside it
+type SyndicationMedia struct {
+	Filename string
+	Type     string
+	Alt      string
+}
+
+// syndicatorFactory makes a target from the config, false if it isn't configured
+type syndicatorFactory func(config Syndics) (Syndicator, bool)
+
+var syndicatorFactories = []syndicatorFactory{}
+
+// registerSyndicator adds a target, for its own file to call from init
+func registerSyndicator(factory syndicatorFactory) {
+	syndicatorFactories = append(syndicatorFactories, factory)
+}
+
+// syndicators is every target configured in ConfigData.Syndication
+func syndicators() []Syndicator {
+	targets := []Syndicator{}
+	for _, factory := range syndicatorFactories {
+		if target, ok := factory(ConfigData.Syndication); ok {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// postWantsCrosspost crossposts the post to every target it asks for, and
+// commits the links back to the repository
+func postWantsCrosspost(frontmatter *FrontMatter, filename string) {
+	if NoCrosspost {
+		return
+	}
+	for _, target := range syndicators() {
+		if !target.Wants(*frontmatter) {
+			continue
+		}
+		link, err := target.Post(target.Format(frontmatter))
+		if err != nil {
+			PrintIfNotSilent("X")
+			buildReport.add(filename, "crosspost", fmt.Errorf("%s %v", target.Name(), err))
+			continue
+		}
+		buildReport.add(filename, "crosspost", target.RecordLink(filename, frontmatter, link))
+		GitAdd(filename)
+		GitCommit(crosspostCommitMessage(target.Name(), link))
+		GitPush()
+	}
+}
+
+// crosspostCommits starts the message committing each target's links, as the
+// repository's history already has them
+var crosspostCommits = map[string]string{"Mastodon": "XPOST", "Bluesky": "BPOST"}
+
+func crosspostCommitMessage(name string, link string) string {
+	prefix, ok := crosspostCommits[name]
+	if !ok {
+		prefix = "XPOST " + name
+	}
+	return fmt.Sprintf("%s - %s", prefix, link)
+}
+
+// wantsSyndication is true if the link is waiting on a crosspost
+func wantsSyndication(link string) bool {
+	return link == "XPOST"
+}
+
+// setSyndicationLink replaces the XPOST of the target in the post's source
+// file with the link to the crosspost
+func setSyndicationLink(filename string, name string, link string) error {
+	filename = filepath.Join(ConfigData.RepositoryDir, filename)
+	mep, err := os.ReadFile(filename)
+	if err == nil {
+		replc := regexp.MustCompile(regexp.QuoteMeta(name) + `:[ '"]*XPOST[ '"]*`)
+		mep := replc.ReplaceAllLiteral(mep, []byte(fmt.Sprintf(`%s: "%s"`, name, link)))
+		err = os.WriteFile(filename, mep, 0777)
+	}
+	return err
+}
+
+// syndicationMedia is the post's feature image and attached media found in
+// the repository, with their alt text
+func syndicationMedia(frontmatter *FrontMatter) []SyndicationMedia {
+	media := []SyndicationMedia{}
+	seen := map[string]bool{}
+	for _, link := range append([]string{frontmatter.FeatureImage}, frontmatter.AttachedMedia...) {
+		filename, fileType, ok := mediaFile(link)
+		if !ok || seen[filename] {
+			continue
+		}
+		seen[filename] = true
+		media = append(media, SyndicationMedia{Filename: filename, Type: fileType, Alt: mediaAlt(frontmatter, link)})
+	}
+	return media
+}
+
+var imageTag = regexp.MustCompile(`<img\s[^>]*>`)
+var imageAttribute = regexp.MustCompile(`\s(src|alt)="([^"]*)"`)
+
+// mediaAlt is the alt text of the media from MediaAlt, or else from the
+// image in the post
+func mediaAlt(frontmatter *FrontMatter, link string) string {
+	if alt, ok := frontmatter.MediaAlt[link]; ok {
+		return alt
+	}
+	for _, tag := range imageTag.FindAllString(frontmatter.Content, -1) {
+		attributes := map[string]string{}
+		for _, attribute := range imageAttribute.FindAllStringSubmatch(tag, -1) {
+			attributes[attribute[1]] = html.UnescapeString(attribute[2])
+		}
+		if attributes["src"] == link || absoluteLink(attributes["src"]) == absoluteLink(link) {
+			return attributes["alt"]
+		}
+	}
+	return ""
+}
+
+// syndicationLanguage is the ISO 639 language of the blog, en for en-au
+func syndicationLanguage() string {
+	return strings.ToLower(strings.Split(ConfigData.Metadata.Language, "-")[0])
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/colinmo/vonblog/utils/mocks"
+)
+
+func TestPostWantsCrosspost(t *testing.T) {
+	keepConfig(t)
+	previousReport, previousClient, previousGit, previousNoCrosspost := buildReport, Client, gitCommand, NoCrosspost
+	t.Cleanup(func() {
+		buildReport, Client, gitCommand, NoCrosspost = previousReport, previousClient, previousGit, previousNoCrosspost
+	})
+	buildReport = newBuildReport()
+	gitCommand = "true"
+	NoCrosspost = false
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md": "---\nTitle: One\nSyndication:\n  Mastodon: XPOST\n  Bluesky: XPOST\n---\nBody",
+	})
+	ConfigData.Syndication = Syndics{
+		Mastodon: Mastodon{URL: "https://mstdn.example.com/api/", Token: "token"},
+	}
+	if len(syndicators()) != 1 || syndicators()[0].Name() != "Mastodon" {
+		t.Fatalf("Unconfigured target registered %v", syndicators())
+	}
+	ConfigData.TempDir = t.TempDir()
+	ConfigData.Syndication.Bluesky = Bluesky{URL: "https://bsky.example.com/", Userid: "professor", Password: "secret"}
+	sent := map[string]string{}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		sent[req.URL.String()] = string(body)
+		response := `{}`
+		switch req.URL.String() {
+		case "https://mstdn.example.com/api/v1/statuses":
+			response = `{"id":"1","url":"https://mstdn.example.com/@professor/1"}`
+		case "https://bsky.example.com/xrpc/com.atproto.server.createSession":
+			response = `{"accessJwt":"access"}`
+		case "https://bsky.example.com/xrpc/com.atproto.repo.createRecord":
+			return &http.Response{StatusCode: 400, Body: io.NopCloser(strings.NewReader(`{"error":"InvalidRequest"}`))}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(response))}, nil
+	}
+	frontmatter := FrontMatter{Title: "One", Synopsis: "First", Link: "https://vonexplaino.com/blog/one.html", Tags: []string{"code"},
+		SyndicationLinks: SyndicationLinksS{Mastodon: "XPOST", Bluesky: "XPOST"}}
+
+	postWantsCrosspost(&frontmatter, "posts/article/one.md")
+	status, _ := url.ParseQuery(sent["https://mstdn.example.com/api/v1/statuses"])
+	if status.Get("status") != "First\n\nhttps://vonexplaino.com/blog/one.html\n#code" {
+		t.Fatalf("Wrong status %v", status)
+	}
+	if frontmatter.SyndicationLinks.Mastodon != "https://mstdn.example.com/@professor/1" || frontmatter.SyndicationLinks.Bluesky != "XPOST" {
+		t.Fatalf("Wrong links %v", frontmatter.SyndicationLinks)
+	}
+	source, _ := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, "posts/article/one.md"))
+	if !strings.Contains(string(source), `Mastodon: "https://mstdn.example.com/@professor/1"`) || !strings.Contains(string(source), "Bluesky: XPOST") {
+		t.Fatalf("Wrong links in the source\n%s", source)
+	}
+	if len(buildReport.Errors) != 1 || !strings.HasPrefix(buildReport.Errors[0].Error, "Bluesky failed in posting to bluesky") {
+		t.Fatalf("Failed crosspost not reported %v", buildReport.Errors)
+	}
+	for name, message := range map[string]string{"Mastodon": "XPOST - link", "Bluesky": "BPOST - link", "Other": "XPOST Other - link"} {
+		if crosspostCommitMessage(name, "link") != message {
+			t.Fatalf("Wrong commit message for %s %s", name, crosspostCommitMessage(name, "link"))
+		}
+	}
+}
+
+func TestCrosspostLinksRecorded(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest, previousClient, previousGit, previousNoCrosspost := buildReport, siteManifest, Client, gitCommand, NoCrosspost
+	t.Cleanup(func() {
+		buildReport, siteManifest, Client, gitCommand, NoCrosspost = previousReport, previousManifest, previousClient, previousGit, previousNoCrosspost
+	})
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	gitCommand = "true"
+	NoCrosspost = false
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/one.md": "---\nTitle: One\nCreated: 2024-05-01T10:00:00+1000\nSyndication:\n  Mastodon: XPOST\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Syndication = Syndics{Mastodon: Mastodon{URL: "https://mstdn.example.com/api/", Token: "token"}}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"id":"1","url":"https://mstdn.example.com/@professor/1"}`))}, nil
+	}
+	tags, postsById := map[string][]FrontMatter{}, map[string]Item{}
+
+	frontmatter, err := writeMDFile(&tags, &postsById, "posts/article/one.md", renderMDFile("posts/article/one.md"))
+	if err != nil {
+		t.Fatalf("Failed to write the post %v", err)
+	}
+	// The manifest has the source as it is with the link
+	source, _ := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, "posts/article/one.md"))
+	entry := siteManifest.Entries["posts/article/one.md"]
+	if entry.FrontMatter.SyndicationLinks.Mastodon != "https://mstdn.example.com/@professor/1" || entry.Hash != hashContent(source) {
+		t.Fatalf("Crosspost link not in the manifest %v", entry)
+	}
+	if postsById[frontmatter.Link].Comments != "https://mstdn.example.com/@professor/1" {
+		t.Fatalf("Crosspost link not in the feed %v", postsById[frontmatter.Link])
+	}
+}
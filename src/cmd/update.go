@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
@@ -26,8 +25,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -38,7 +40,8 @@ var formatStringDMonthYear = "2 January 2006"
 /*
 Perform a full regenerate from source.
 1. Build the new site in a new folder under TempDir.
-2. Replace the existing symlink with this location
+2. Once deleteAndRegenerate has finished it, replace the existing symlink with this location
+3. Keep the last few builds for a rollback
 */
 func updateFullRegenerate() (
 	allPosts RSS,
@@ -49,6 +52,11 @@ func updateFullRegenerate() (
 	err error) {
 
 	PrintIfNotSilent("Full\n")
+	// The last build, to redirect any posts that have moved since
+	previous, _ := loadManifest(manifestDir())
+	siteManifest = newManifest()
+	// Feeds are only news to the hub if they differ from the last build
+	siteManifest.Feeds = previous.Feeds
 	postsById = map[string]Item{}
 	allPosts = RSS{}
 	tags = map[string][]FrontMatter{}
@@ -57,25 +65,20 @@ func updateFullRegenerate() (
 	// Make new target directory
 	PrintIfNotSilent("Temp Dir\n")
 	SwapDir2 := ConfigData.BaseDir
-	dirName := time.Now().Format("20060102150405")
+	dirName := time.Now().Format(releaseFormat)
 	ConfigData.BaseDir = filepath.Join(ConfigData.TempDir, dirName)
 	for _, d := range []string{"tag", "media", "posts"} {
 		dirPath := filepath.Join(ConfigData.BaseDir, d)
 		err = os.MkdirAll(dirPath, 0755)
 		if err != nil {
-			log.Fatalf("Make %s dir error %v\n", d, err)
-		}
-		info, err := os.Stat(dirPath)
-		if os.IsNotExist(err) {
-			log.Fatal("File does not exist.")
-		}
-		if !info.IsDir() {
-			log.Fatalf("%s is not a directory", dirPath)
+			ConfigData.BaseDir = SwapDir2
+			err = fmt.Errorf("make %s dir error %v", d, err)
+			return
 		}
 	}
 
 	// Run the generate into the target directory
-	GitPull()
+	buildReport.add("", "git", GitPull())
 	changes, err = PopulateAllGitFiles(ConfigData.RepositoryDir)
 	if err != nil {
 		os.RemoveAll(ConfigData.BaseDir)
@@ -84,37 +87,48 @@ func updateFullRegenerate() (
 		return
 	}
 	tags, filesToDelete, postsById = getAllChangedTagsAndDeletedFiles(changes, postsById)
-	tags, postsById, _ = processFileUpdates(changes, tags, postsById)
+	tags, postsById = processFileUpdates(changes, tags, postsById)
+	siteManifest.redirectMoved(previous)
+	// Every page was just rendered with the current templates
+	siteManifest.Templates, _ = hashFiles(templateDir(), []string{""})
 
-	// Swap the directory symlink
-	PrintIfNotSilent("\nSwap across\n")
-	replaceDirectory(ConfigData.BaseDir, SwapDir2)
-	// Remove old dir
-	clearOtherPaths(ConfigData.TempDir, dirName)
-	ConfigData.BaseDir = SwapDir2
+	// The rest of the site is written into the build before it goes live
+	pendingRelease = siteRelease{Dir: ConfigData.BaseDir, Link: SwapDir2, ID: dirName}
 	return
 }
 
-func clearOtherPaths(inDir, notThisOne string) {
-	items, _ := os.ReadDir(inDir)
-	for _, item := range items {
-		if item.Name() < notThisOne {
-			os.RemoveAll(filepath.Join(inDir, item.Name()))
-		}
-	}
+// siteRelease is a full regenerate's build, waiting to replace the site
+type siteRelease struct {
+	Dir  string
+	Link string
+	ID   string
 }
 
-func replaceDirectory(tempDir, blogDir string) {
-	var err error
-	blogDir = filepath.Clean(blogDir)
-	err = os.Remove(blogDir)
-	if err != nil && (len(err.Error()) <= 25 || err.Error()[len(err.Error())-25:] != `no such file or directory`) {
-		log.Fatalf("Could not remove dir %v for linking to %v\n%v", blogDir, tempDir, err.Error())
+var pendingRelease siteRelease
+
+// publishRelease swaps the directory symlink to the build being written, if
+// it's a full regenerate, and removes the old builds
+func publishRelease() error {
+	if pendingRelease.Dir == "" || pendingRelease.Dir != ConfigData.BaseDir {
+		return nil
+	}
+	build := pendingRelease
+	pendingRelease = siteRelease{}
+	ConfigData.BaseDir = build.Link
+	PrintIfNotSilent("\nSwap across\n")
+	if err := replaceDirectory(build.Dir, build.Link); err != nil {
+		return err
 	}
-	err = os.Symlink(tempDir, blogDir)
+	pruneReleases(ConfigData.TempDir, ConfigData.KeepBuilds, build.ID)
+	return nil
+}
+
+func replaceDirectory(tempDir, blogDir string) error {
+	err := swapSymlink(tempDir, blogDir)
 	if err != nil {
-		log.Fatalf("one: %s\n", err)
+		return fmt.Errorf("could not link %v to %v [%v]", blogDir, tempDir, err)
 	}
+	return nil
 }
 
 func updateChangedRegenerate() (
@@ -136,23 +150,82 @@ func updateChangedRegenerate() (
 		err = fmt.Errorf("failed to read the RSS file %v", err)
 		return
 	}
-	for _, i := range allPosts.Channel.Items {
-		postsById[i.GUID] = i
-	}
-	changes = GitRunDiff()
+	postsById = changedPostsById(allPosts)
+	changes = addExpired(GitRunDiff())
 	// Get the tags to update and files to delete
 	tags, filesToDelete, postsById = getAllChangedTagsAndDeletedFiles(changes, postsById)
 	// Update the files
-	GitPull()
+	buildReport.add("", "git", GitPull())
 	// Get the changed tags, building the new pages as we go
-	tags, postsById, err = processFileUpdates(changes, tags, postsById)
+	tags, postsById = processFileUpdates(changes, tags, postsById)
 	return
 }
 
+/*
+Regenerate whatever changed since the last build, going by the hashes in the
+build manifest rather than the git diff. Picks up template changes, edits that
+were never committed, and anything a missed update skipped.
+*/
+func updateHashRegenerate() (
+	allPosts RSS,
+	tags map[string][]FrontMatter,
+	postsById map[string]Item,
+	filesToDelete map[string]struct{},
+	changes GitDiffs,
+	err error) {
+
+	PrintIfNotSilent("Hash\n")
+	buildReport.add("", "git", GitPull())
+	if !loadSiteManifest() {
+		PrintIfNotSilent("No build manifest, rebuilding every file\n")
+	}
+	// Renames show up as a delete and an add, so match them up afterwards
+	previous, _ := loadManifest(manifestDir())
+	postsById = siteManifest.postsById()
+	changes, templates, err := hashChanges(templateDir())
+	if err != nil {
+		err = fmt.Errorf("failed to hash the files %v", err)
+		return
+	}
+	changes = addExpired(changes)
+	tags, filesToDelete, postsById = getAllChangedTagsAndDeletedFiles(changes, postsById)
+	tags, postsById = processFileUpdates(changes, tags, postsById)
+	siteManifest.redirectMoved(previous)
+	siteManifest.Templates = templates
+	// Every source missing from the manifest was just rebuilt, so it has them all now
+	siteManifest.Partial = false
+	return
+}
+
+// addExpired adds the posts that expired since they were built to the
+// changes, so they're rebuilt as retired
+func addExpired(changes GitDiffs) GitDiffs {
+	changed := map[string]bool{}
+	for _, group := range [][]string{
+		changes.Added,
+		changes.CopyEdit,
+		changes.Modified,
+		changes.RenameEdit,
+		changes.Unmerged,
+		changes.Deleted} {
+		for _, filename := range group {
+			changed[manifestKey(filename)] = true
+		}
+	}
+	for _, filename := range siteManifest.expired(DateOfExecution) {
+		if !changed[filename] {
+			changes.Modified = append(changes.Modified, filename)
+		}
+	}
+	return changes
+}
+
 func deleteFiles(filesToDelete map[string]struct{}) {
 	for filename := range filesToDelete {
 		PrintIfNotSilent("Deleting " + filepath.Join(ConfigData.BaseDir, filename))
-		os.Remove(filepath.Join(ConfigData.BaseDir, filename))
+		if err := os.Remove(filepath.Join(ConfigData.BaseDir, filename)); !os.IsNotExist(err) {
+			buildReport.add(filename, "delete", err)
+		}
 	}
 }
 
@@ -160,8 +233,12 @@ func regenerateIndexAndRSS(allPosts RSS, postsById map[string]Item) map[string][
 	allTagMap := map[string][]FrontMatter{}
 	allPosts.Channel.Items = []Item{}
 	allItems := []FrontMatter{}
+	posts := siteManifest.byLink()
 	for _, i := range postsById {
-		newPost := ItemToPost(i)
+		newPost, ok := posts[i.GUID]
+		if !ok {
+			newPost = ItemToPost(i)
+		}
 		allPosts.Channel.Items = append(allPosts.Channel.Items, i)
 		allItems = append(allItems, newPost)
 		for _, j := range newPost.Tags {
@@ -171,14 +248,34 @@ func regenerateIndexAndRSS(allPosts RSS, postsById map[string]Item) map[string][
 			allTagMap[j] = append(allTagMap[j], newPost)
 		}
 	}
-	WriteRSS(allPosts, "/all-rss.xml", -1)
-	WriteRSS(allPosts, "/rss.xml", 10)
-	WriteListHTML(allItems, "index", "Journal")
+	allChannel, err := feedChannel("all", FeedVars{})
+	buildReport.add("all-rss.xml", "feed", err)
+	allPosts.Channel.Title, allPosts.Channel.Description, allPosts.Channel.Link = allChannel.Title, allChannel.Description, allChannel.Link
+	buildReport.add("all-rss.xml", "feed", WriteRSS(allPosts, "/all-rss.xml", -1))
+	latestChannel, err := feedChannel("latest", FeedVars{})
+	buildReport.add("rss.xml", "feed", err)
+	allPosts.Channel.Title, allPosts.Channel.Description, allPosts.Channel.Link = latestChannel.Title, latestChannel.Description, latestChannel.Link
+	buildReport.add("rss.xml", "feed", WriteRSSArchive(allPosts, "/rss.xml", latestFeedLimit))
+	indexLink, _ := url.JoinPath(ConfigData.BaseURL, "index-1.html")
+	buildReport.add("all-atom.xml", "feed", WriteAtom(PostsToAtom(allItems, allChannel.Title, allChannel.Description, indexLink), "all-atom.xml", -1))
+	buildReport.add("atom.xml", "feed", WriteAtom(PostsToAtom(allItems, latestChannel.Title, latestChannel.Description, indexLink), "atom.xml", latestFeedLimit))
+	buildReport.add("feed.json", "feed", WriteJSONFeed(PostsToJSONFeed(allItems, latestChannel.Title, latestChannel.Description, indexLink), "feed.json", latestFeedLimit))
+	buildReport.add("index", "index", WriteListHTML(allItems, "index", "Journal"))
+	episodes := []FrontMatter{}
+	for _, post := range allItems {
+		if post.Type == "episode" {
+			episodes = append(episodes, post)
+		}
+	}
+	if len(episodes) > 0 {
+		buildReport.add(podcastFilename, "feed", WritePodcast(episodes, podcastFilename))
+	}
 	for _, top := range allItems {
 		if top.Type != "indieweb" && top.Status != "draft" {
 			err := WriteLatestPost(top)
 			if err != nil {
 				fmt.Printf("\nFailed to update homepage with latest %s\n", err)
+				buildReport.add("posts/page/welcome.html", "index", err)
 			}
 			break
 		}
@@ -205,22 +302,39 @@ func deleteAndRegenerate(
 ) {
 	// Delete any linked deleted HTML or Media pages
 	deleteFiles(filesToDelete)
-	// Regenerate the index pages and RSS feeds
+	// Regenerate the index pages and RSS feeds, with every post for each changed tag
+	tags = completeTags(tags, postsById)
 	createPageAndRSSForTags(tags)
 	// Regenerate the all published posts RSS file
 	allTagMap := regenerateIndexAndRSS(allPosts, postsById)
+	// And the lists by type of post and by date
+	createTypeAndDatePages()
+	// And the OPML of the feeds, and the blogroll
+	writeOPMLFiles()
 	// Create tag-page for Code and Steampunk embedding
 	for _, tag := range ConfigData.TagSnippets {
 		PrintIfNotSilent(fmt.Sprintf("Regenerating snippet for %s (%d) - ", tag, len(allTagMap[tag])))
 		content, err := createTagPageSnippetForTag(tag, allTagMap[tag])
 		if err == nil {
 			PrintIfNotSilent("ok\n")
-			os.WriteFile(filepath.Join(ConfigData.BaseDir, "tag-snippet-"+tag+".html"), content, 0666)
-		} else {
+			err = os.WriteFile(filepath.Join(ConfigData.BaseDir, "tag-snippet-"+tag+".html"), content, 0666)
+		}
+		if err != nil {
 			PrintIfNotSilent(fmt.Sprintf("Failed %v", err))
 			fmt.Printf("failed %v\n", err)
+			buildReport.add("tag-snippet-"+tag+".html", "snippet", err)
 		}
 	}
+	// Send the old pages of moved posts on to where they are now
+	writeRedirects()
+	writeSiteManifest()
+	// Only now is a full regenerate's build complete enough to go live
+	buildReport.add("", "release", publishRelease())
+	// Tell the hub which feeds have something new, now they're live, and
+	// remember the ones it accepted
+	if pingHub() {
+		writeSiteManifest()
+	}
 	outputStats(changes)
 }
 
@@ -261,8 +375,7 @@ func createTagPageSnippetForTag(tag string, tagsForString []FrontMatter) ([]byte
 		"tag-related-tags",
 		templateTags,
 	); err != nil {
-		fmt.Printf("Couldn't write the file3\n")
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return buf.Bytes(), err
@@ -272,7 +385,10 @@ func createTagPageSnippetForTag(tag string, tagsForString []FrontMatter) ([]byte
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update the blog",
-	Long:  `Runs the markdown to html conversion process over the site`,
+	Long: `Runs the markdown to html conversion process over the site
+
+Files that fail are skipped and listed in build-report.json in the BaseDir.
+Exits with 3 if the site was built with failures, or 1 if the update couldn't run.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get the list of changed files
 		var changes GitDiffs
@@ -284,36 +400,67 @@ var updateCmd = &cobra.Command{
 
 		SetupTemplate()
 
+		if DryRun {
+			plan, err := planUpdate()
+			if err != nil {
+				log.Fatalf("Something happened planning the update\n%v\n", err)
+			}
+			printPlan(plan, PlanAsJSON)
+			return
+		}
+
+		buildReport = newBuildReport()
 		if FullRegenerate {
+			buildReport.Mode = "full"
 			allPosts, tags, postsById, filesToDelete, changes, err = updateFullRegenerate()
+		} else if HashRegenerate {
+			buildReport.Mode = "hash"
+			allPosts, tags, postsById, filesToDelete, changes, err = updateHashRegenerate()
 		} else {
+			buildReport.Mode = "changed"
 			allPosts, tags, postsById, filesToDelete, changes, err = updateChangedRegenerate()
 		}
 
 		if err != nil {
+			buildReport.add("", "update", err)
+			buildReport.write(ConfigData.BaseDir)
 			log.Fatalf("Something happened updating files\n%v\n", err)
-		} else {
-			deleteAndRegenerate(allPosts, tags, postsById, filesToDelete, changes)
 		}
+		deleteAndRegenerate(allPosts, tags, postsById, filesToDelete, changes)
+		finishBuild()
 	},
 }
 
 var FullRegenerate bool
+var HashRegenerate bool
+var Jobs int
 var Silent bool
 var Totals bool
+var NoCrosspost bool
+var DryRun bool
+var PlanAsJSON bool
 
 func getAllChangedTagsAndDeletedFiles(changes GitDiffs, postsById map[string]Item) (map[string][]FrontMatter, map[string]struct{}, map[string]Item) {
-	var tags map[string][]FrontMatter
-	var filesToDelete map[string]struct{}
+	tags := map[string][]FrontMatter{}
+	filesToDelete := map[string]struct{}{}
 	var linkString string
+	var err error
 	// Get the old tags from the changed files
 	for _, filename := range changes.CopyEdit {
 		tags, _, _ = getTagsFromPost(filename, tags)
 	}
 	for _, filename := range changes.Deleted {
+		if entry, ok := siteManifest.remove(filename); ok {
+			// The manifest knows the page, even if the source is already gone
+			filesToDelete[entry.Output] = struct{}{}
+			touchTags(tags, entry.Tags)
+			delete(postsById, entry.FrontMatter.Link)
+			continue
+		}
 		tags, _, _ = getTagsFromPost(filepath.Join(ConfigData.BaseDir, filename), tags)
 		// Get the linked HTML page for deleted files
-		filesToDelete, linkString = getTargetFilenameFromPost(filename, filesToDelete)
+		filesToDelete, linkString, err = getTargetFilenameFromPost(filename, filesToDelete)
+		buildReport.add(filename, "delete", err)
 		// Delete it from the Tag list as found in the RSS file
 		if linkString != "" {
 			delete(postsById, linkString)
@@ -323,6 +470,10 @@ func getAllChangedTagsAndDeletedFiles(changes GitDiffs, postsById map[string]Ite
 		tags, _, _ = getTagsFromPost(filename, tags)
 	}
 	for _, filename := range changes.RenameEdit {
+		if from, ok := changes.RenamedFrom[filename]; ok {
+			// Carry the old page over, so the post is redirected if its link changed
+			siteManifest.rename(from, filename)
+		}
 		tags, _, _ = getTagsFromPost(filename, tags)
 	}
 	for _, filename := range changes.Unmerged {
@@ -340,7 +491,7 @@ func getTagsFromPost(postName string, tags map[string][]FrontMatter) (map[string
 	}
 	if postName[len(postName)-3:] == ".md" {
 		html, frontmatter, err = parseFile(filepath.Join(ConfigData.RepositoryDir, postName))
-		if err == nil && frontmatter.Status != "draft" {
+		if err == nil && !isUnpublished(frontmatter) && !isRetired(frontmatter) {
 			for _, tag := range frontmatter.Tags {
 				tag = strings.ToLower(tag)
 				tags[tag] = append(tags[tag], frontmatter)
@@ -350,86 +501,118 @@ func getTagsFromPost(postName string, tags map[string][]FrontMatter) (map[string
 	return tags, frontmatter, html
 }
 
-func getTargetFilenameFromPost(postName string, files map[string]struct{}) (map[string]struct{}, string) {
+// touchTags makes sure each tag is in the map, so its pages get regenerated
+func touchTags(tags map[string][]FrontMatter, names []string) {
+	for _, name := range names {
+		if _, ok := tags[name]; !ok {
+			tags[name] = []FrontMatter{}
+		}
+	}
+}
+
+func getTargetFilenameFromPost(postName string, files map[string]struct{}) (map[string]struct{}, string, error) {
 	link := ""
 	if files == nil {
 		files = make(map[string]struct{})
 	}
 	if postName[len(postName)-3:] == ".md" {
 		_, frontmatter, err := parseFile(filepath.Join(ConfigData.RepositoryDir, postName))
-		if err == nil {
-			files[frontmatter.RelativeLink] = struct{}{}
-			link = frontmatter.Link
-		} else {
-			log.Fatalf("Couldn't get filename %v\n", err)
+		if err != nil {
+			return files, link, fmt.Errorf("couldn't get filename %v", err)
 		}
+		files[frontmatter.RelativeLink] = struct{}{}
+		link = frontmatter.Link
 	} else {
 		files[postName] = struct{}{}
 	}
-	return files, link
+	return files, link, nil
+}
+
+// renderedPost is a post converted to HTML, waiting to be written
+type renderedPost struct {
+	frontmatter FrontMatter
+	html        string
+	err         error
+}
+
+// renderMDFile converts a post to HTML. It only reads shared state, so posts
+// can be rendered at the same time.
+func renderMDFile(filename string) renderedPost {
+	html, frontmatter, err := parseFile(filepath.Join(ConfigData.RepositoryDir, filename))
+	return renderedPost{frontmatter: frontmatter, html: html, err: err}
 }
 
-func indieWeb(link, label string) string {
-	if len(link) > 0 {
-		return fmt.Sprintf("\n\n%s %s", label, link)
+// renderMDFiles renders the markdown files on up to jobs workers, returning
+// the posts in the same order as the files. Other files are left empty.
+func renderMDFiles(files []string, jobs int) []renderedPost {
+	rendered := make([]renderedPost, len(files))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(jobs, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				rendered[i] = renderMDFile(files[i])
+			}
+		}()
+	}
+	for i, filename := range files {
+		if filepath.Ext(filename) == ".md" {
+			queue <- i
+		}
 	}
-	return ""
+	close(queue)
+	wg.Wait()
+	return rendered
 }
 
-func postWantsCrosspost(frontmatter *FrontMatter, filename string) {
-	if postWantsMastodonCrosspost(*frontmatter) {
-		toSyndicate := frontmatter.Synopsis
-		if frontmatter.Type == "indieweb" {
-			toSyndicate = toSyndicate +
-				fmt.Sprintf("%s%s%s%s%s",
-					indieWeb(frontmatter.InReplyTo, "In reply to"),
-					indieWeb(frontmatter.RepostOf, "Repost of"),
-					indieWeb(frontmatter.LikeOf, "Like of"),
-					indieWeb(frontmatter.FavoriteOf, "Favourite of"),
-					indieWeb(frontmatter.BookmarkOf, "Bookmark of"),
-				)
+func processMDFile(tags *map[string][]FrontMatter, postsById *map[string]Item, filename string) (FrontMatter, error) {
+	return writeMDFile(tags, postsById, filename, renderMDFile(filename))
+}
+
+// writeMDFile writes a rendered post and updates the tags, feeds, manifest
+// and crossposts for it. Never run at the same time as another writeMDFile.
+func writeMDFile(tags *map[string][]FrontMatter, postsById *map[string]Item, filename string, post renderedPost) (FrontMatter, error) {
+	var err error
+	frontmatter, html := post.frontmatter, post.html
+	if post.err != nil {
+		// Leave whatever was published before, rather than a broken page
+		PrintIfNotSilent("E")
+		buildReport.add(filename, "parse", post.err)
+		return frontmatter, post.err
+	}
+	t2 := *tags
+	if t2 == nil {
+		t2 = map[string][]FrontMatter{}
+	}
+	if isUnpublished(frontmatter) {
+		if isScheduled(frontmatter) {
+			PrintIfNotSilent("S")
 		} else {
-			toSyndicate = toSyndicate + "\n\n" + frontmatter.Link
+			PrintIfNotSilent("D")
 		}
-		if len(frontmatter.Tags) > 0 {
-			toSyndicate = toSyndicate + "\n#" + strings.Join(frontmatter.Tags, " #")
+		delete(*postsById, frontmatter.Link)
+		if previous, ok := siteManifest.remove(filename); ok {
+			// Was published, so take it back off the site
+			os.Remove(filepath.Join(ConfigData.BaseDir, previous.Output))
+			touchTags(t2, previous.Tags)
 		}
-		mastodonLink, err := postToMastodon(toSyndicate)
-		if err == nil {
-			mastodonLink, _ = url.JoinPath(`https://mstdn.social/@vonExplaino/`, mastodonLink)
-			setMastodonLink(filename, mastodonLink)
-			GitAdd(filename)
-			GitCommit(fmt.Sprintf("XPOST - %s", mastodonLink))
-			GitPush()
-			frontmatter.SyndicationLinks.Mastodon = mastodonLink
-		} else {
-			PrintIfNotSilent("X")
+		if isScheduled(frontmatter) {
+			siteManifest.schedule(filename, frontmatter.publishDate())
 		}
-	}
-	if postWantsBlueskyCrosspost(*frontmatter) {
-		toSyndicate, facets := makeBlueskyPost(frontmatter)
-		blueskyLink, err := postToBluesky(toSyndicate, facets, frontmatter.CreatedDate)
-		if err == nil {
-			setBlueskyLink(filename, blueskyLink)
-			GitAdd(filename)
-			GitCommit(fmt.Sprintf("BPOST - %s", blueskyLink))
-			GitPush()
-			frontmatter.SyndicationLinks.Bluesky = blueskyLink
+		*tags = t2
+		return frontmatter, nil
+	}
+	for _, tag := range frontmatter.Tags {
+		tag = strings.ToLower(tag)
+		if isRetired(frontmatter) {
+			// Still on the site, but regenerate the tag without it
+			touchTags(t2, []string{tag})
 		} else {
-			PrintIfNotSilent(err.Error())
-			PrintIfNotSilent("Y")
+			t2[tag] = append(t2[tag], frontmatter)
 		}
 	}
-}
-func processMDFile(tags *map[string][]FrontMatter, postsById *map[string]Item, filename string) error {
-	// // If .md Process into HTML
-	var err error
-	t2, frontmatter, html := getTagsFromPost(filename, *tags)
-	if frontmatter.Status == "draft" {
-		PrintIfNotSilent("D")
-		delete(*postsById, frontmatter.Link)
-		return nil
-	}
 	*tags = t2
 	targetFile := filepath.Join(ConfigData.BaseDir, baseDirectoryForPosts, frontmatter.RelativeLink)
 	targetDir, _ := filepath.Split(targetFile)
@@ -437,62 +620,58 @@ func processMDFile(tags *map[string][]FrontMatter, postsById *map[string]Item, f
 		os.MkdirAll(targetDir, 0755)
 	}
 	err = os.WriteFile(targetFile, []byte(html), 0755)
-	if frontmatter.Type == "article" ||
-		frontmatter.Type == "review" ||
-		(frontmatter.Type == "indieweb" &&
-			(len(frontmatter.BookmarkOf) > 0 ||
-				len(frontmatter.LikeOf) > 0)) {
+	buildReport.add(filename, "write", err)
+	if !isRetired(frontmatter) {
+		// Before it's recorded, so the manifest and feeds have the crosspost links
+		postWantsCrosspost(&frontmatter, filename)
+	}
+	if err == nil {
+		source, _ := os.ReadFile(filepath.Join(ConfigData.RepositoryDir, filename))
+		if previous, ok := siteManifest.record(filename, frontmatter, source); ok {
+			touchTags(*tags, previous.Tags)
+			if previous.Output != siteManifest.Entries[manifestKey(filename)].Output {
+				// Moved, so redirect from the old location
+				os.Remove(filepath.Join(ConfigData.BaseDir, previous.Output))
+				delete(*postsById, previous.FrontMatter.Link)
+				siteManifest.addRedirect(previous.Output, previous.FrontMatter.Link, frontmatter.Link)
+			}
+		}
+	}
+	if isRetired(frontmatter) {
+		delete(*postsById, frontmatter.Link)
+		PrintIfNotSilent("R")
+		return frontmatter, err
+	}
+	if isFeedPost(frontmatter) {
 		(*postsById)[frontmatter.Link] = PostToItem(frontmatter)
 	}
-	postWantsCrosspost(&frontmatter, filename)
 	PrintIfNotSilent("P")
-	return err
+	return frontmatter, err
 }
 
-func postWantsMastodonCrosspost(fm FrontMatter) bool {
-	return fm.SyndicationLinks.Mastodon == "XPOST"
+// isScheduled is a post to publish on a later run, by publish-due
+func isScheduled(frontmatter FrontMatter) bool {
+	return frontmatter.Status != "draft" && frontmatter.publishDate().After(DateOfExecution)
 }
 
-func setMastodonLink(filename string, mastodonLink string) {
-	filename = filepath.Join(ConfigData.RepositoryDir, filename)
-	mep, err := os.ReadFile(filename)
-	if err == nil {
-		replc := regexp.MustCompile(`Mastodon:[ '"]*XPOST[ '"]*`)
-		mep := replc.ReplaceAll(mep, []byte(fmt.Sprintf(`Mastodon: "%s"`, mastodonLink)))
-		os.WriteFile(filename, mep, 0777)
-	}
+// isUnpublished is a post to keep off the site, for now or for good
+func isUnpublished(frontmatter FrontMatter) bool {
+	return frontmatter.Status == "draft" || isScheduled(frontmatter)
 }
 
-func postToMastodon(message string) (string, error) {
-	type mastodonMostResponse struct {
-		ID string `json:"id"`
-	}
-	data := url.Values{
-		"status":     {message},
-		"visibility": {"public"}, // testing
-	}
-	request, _ := http.NewRequest(
-		"POST",
-		ConfigData.Syndication.Mastodon.URL+"v1/statuses",
-		bytes.NewBuffer([]byte(data.Encode())),
-	)
-	request.Header.Set(jsonHeaders[0][0], jsonHeaders[0][1])
-	request.Header.Set("Content-type", "application/x-www-form-urlencoded")
-	request.Header.Set("Authorization", "Bearer "+ConfigData.Syndication.Mastodon.Token)
-	resp, err := Client.Do(request)
-	if err != nil {
-		return "", err
-	}
-	var res mastodonMostResponse
-	json.NewDecoder(resp.Body).Decode(&res)
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("failed in posting to mastodon [%d]", resp.StatusCode)
-	}
-	if res.ID != "" {
-		return res.ID, nil
-	} else {
-		return "", fmt.Errorf("failed in post to mastodon attempt %s|%d", res, resp.StatusCode)
-	}
+// isRetired is a post that keeps its page, but is left out of the lists and feeds
+func isRetired(frontmatter FrontMatter) bool {
+	return frontmatter.Status == "retired"
+}
+
+// isFeedPost is true for the post types that make it into the index and main RSS feeds
+func isFeedPost(frontmatter FrontMatter) bool {
+	return frontmatter.Type == "article" ||
+		frontmatter.Type == "review" ||
+		frontmatter.Type == "episode" ||
+		(frontmatter.Type == "indieweb" &&
+			(len(frontmatter.BookmarkOf) > 0 ||
+				len(frontmatter.LikeOf) > 0))
 }
 
 func processMediaFile(filename string) error {
@@ -520,9 +699,11 @@ func processUnknownFile(filename string) error {
 	return err
 }
 
-func processFileUpdates(changes GitDiffs, tags map[string][]FrontMatter, postsById map[string]Item) (map[string][]FrontMatter, map[string]Item, error) {
-	var errors []string
+// processFileUpdates builds every changed file, carrying on past any that
+// fail. The failures are in the buildReport.
+func processFileUpdates(changes GitDiffs, tags map[string][]FrontMatter, postsById map[string]Item) (map[string][]FrontMatter, map[string]Item) {
 	var err error
+	files := []string{}
 	for _, group := range [][]string{
 		changes.Added,
 		changes.CopyEdit,
@@ -530,85 +711,117 @@ func processFileUpdates(changes GitDiffs, tags map[string][]FrontMatter, postsBy
 		changes.RenameEdit,
 		changes.Unmerged} {
 		for _, filename := range group {
-			filename = strings.ReplaceAll(filename, `\`, `/`)
-			extension := filepath.Ext(filename)
-			if extension == ".md" {
-				err = processMDFile(&tags, &postsById, filename)
-			} else if (filename[0:5] == "media" || filename[0:6] == "/media") && (IsMedia(filepath.Join(ConfigData.RepositoryDir, filename)) || extension == ".mov") {
-				err = processMediaFile(filename)
-			} else {
-				err = processUnknownFile(filename)
-			}
-			if err != nil {
-				errors = append(errors, err.Error())
-			}
+			files = append(files, strings.ReplaceAll(filename, `\`, `/`))
 		}
 	}
-	if len(errors) > 0 {
-		err = fmt.Errorf("errors during update: %s", strings.Join(errors, ""))
+	// Render in parallel, then write in order so the output and
+	// crossposting are the same as rendering one at a time
+	rendered := renderMDFiles(files, Jobs)
+	for i, filename := range files {
+		extension := filepath.Ext(filename)
+		if extension == ".md" {
+			// Reports its own errors, by stage
+			_, err = writeMDFile(&tags, &postsById, filename, rendered[i])
+		} else if (filename[0:5] == "media" || filename[0:6] == "/media") && (IsMedia(filepath.Join(ConfigData.RepositoryDir, filename)) || extension == ".mov") {
+			err = processMediaFile(filename)
+			buildReport.add(filename, "media", err)
+		} else {
+			err = processUnknownFile(filename)
+			buildReport.add(filename, "copy", err)
+		}
+		if err == nil {
+			siteManifest.recordSource(filename)
+		}
 	}
-	return tags, postsById, err
+	return tags, postsById
 }
 
-func createPageAndRSSForTags(tags map[string][]FrontMatter) {
-	// NEW IDEA
-	// Read the main RSS feed of all content first, that'll give us all entries AND all tags
-	// Then we delete any tags+entries that been deleted
-	// Add the rest
-	// And regenerate the main page and all changed tags
-	baseDir := ConfigData.BaseDir
-	matchExp, _ := regexp.Compile(`^(.*)-[\d+].xml$`)
-	files, err := os.ReadDir(baseDir)
-	if err != nil {
-		fmt.Printf("Failed to read existing RSS files from [%s]\n[%s]\n", baseDir, err)
-		log.Fatal(err)
+// completeTags is every post for each of the changed tags, including tags
+// that no longer have any. The manifest has every post, but if the last build
+// didn't leave one the main feed fills in the rest, and a tag without posts
+// is left alone as it may only be missing from both.
+func completeTags(tags map[string][]FrontMatter, postsById map[string]Item) map[string][]FrontMatter {
+	complete := siteManifest.retag(tags)
+	for tag := range tags {
+		listed := map[string]bool{}
+		for _, post := range complete[tag] {
+			listed[post.Link] = true
+		}
+		for link, item := range postsById {
+			if !listed[link] && hasTag(item.Tags, tag) {
+				complete[tag] = append(complete[tag], ItemToPost(item))
+				listed[link] = true
+			}
+		}
+		if len(complete[tag]) > 0 {
+			continue
+		}
+		if siteManifest.Partial {
+			delete(complete, tag)
+		} else {
+			complete[tag] = []FrontMatter{}
+		}
 	}
+	return complete
+}
 
-	// Get the new list of pages for each tag
-	tagsAndFiles := make(map[string][]string)
-	for _, f := range files {
-		matches := matchExp.FindStringSubmatch(f.Name())
-		if len(matches) > 0 {
-			tagsAndFiles[matches[1]] = append(tagsAndFiles[matches[1]], f.Name())
+// hasTag is true if the tag is one of the tags, whatever its case
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
 		}
 	}
-	// For each tag
+	return false
+}
+
+// createPageAndRSSForTags rewrites the pages and feeds of each tag from the
+// full list of its posts, and removes those of tags without any posts
+func createPageAndRSSForTags(tags map[string][]FrontMatter) {
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "tag"), 0755)
 	for tag, frontMatters := range tags {
-		var rss RSS
-		var items []FrontMatter
-		// Process all RSS feed files for that tag
-		for _, f := range tagsAndFiles[textToSlug(tag)] {
-			rss, err = ReadRSS(baseDir + string(os.PathSeparator) + f)
-			if err != nil {
-				fmt.Printf("Failed to read existing RSS file")
-				log.Fatal(err)
+		filename := "tag/" + textToSlug(tag)
+		// Once each, however many times the post was edited
+		items := []FrontMatter{}
+		seen := map[string]bool{}
+		for _, post := range frontMatters {
+			if !seen[post.Link] {
+				seen[post.Link] = true
+				items = append(items, post)
 			}
 		}
-		if rss.Channel.Title == "" {
-			tagLink, _ := url.JoinPath(ConfigData.BaseURL, "tag", textToSlug(tag)+".xml")
-			// New!
-			rss.Channel = Channel{
-				Title:         "Professor von Explain Feed Tagged " + tag,
-				Link:          tagLink,
-				Description:   "A feed of posts containing the tag '" + tag + "'",
-				Language:      "",
-				Copyright:     "",
-				LastBuildDate: time.Now().String(),
-				Generator:     "Hand crafted nonsense written in Go",
-				WebMaster:     "professor@vonexplaino.com (Colin Morris)",
-				TimeToLive:    "3600",
-				Items:         []Item{},
-			}
+		if len(items) == 0 {
+			buildReport.add(filename, "tags", deleteTagFiles(filename))
+			continue
 		}
-		// Add new ones
-		for _, post := range frontMatters {
-			rss.Channel.Items = append(rss.Channel.Items, PostToItem(post))
-			items = append(items, post)
+		writeListFeeds("tag", FeedVars{Tag: tag, Slug: textToSlug(tag)}, filename, items, listFeedLimit)
+		buildReport.add(filename, "tags", WriteListHTML(items, filename, "Tag: "+tag))
+		// Fewer posts than before, so drop the pages past the end
+		removeNumberedFiles(filename, ".html", listPageCount(len(items)))
+	}
+}
+
+// deleteTagFiles removes the pages, feeds and feed archives of a tag
+func deleteTagFiles(filename string) error {
+	for _, ext := range []string{".xml", ".atom", ".json"} {
+		if err := os.Remove(filepath.Join(ConfigData.BaseDir, filename+ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(siteManifest.Feeds, filename+ext)
+	}
+	removeNumberedFiles(filename, ".html", 0)
+	removeNumberedFiles(strings.TrimSuffix(archiveFilename(filename, 0), "-0.xml"), ".xml", 0)
+	return nil
+}
+
+// removeNumberedFiles removes the numbered pages (tag/code-3.html) after keep
+func removeNumberedFiles(prefix string, ext string, keep int) {
+	existing, _ := filepath.Glob(filepath.Join(ConfigData.BaseDir, prefix+"-*"+ext))
+	for _, numbered := range existing {
+		page, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(numbered), filepath.Base(prefix)+"-"), ext))
+		if err == nil && page > keep {
+			os.Remove(numbered)
 		}
-		// Regenerate RSS feeds and HTML pages for each Tag and Index
-		filename := "tag/" + textToSlug(tag)
-		WriteRSS(rss, fmt.Sprintf("%s.xml", filename), 20)
-		WriteListHTML(items, filename, "Tag: "+tag)
 	}
 }
 
@@ -672,7 +885,7 @@ func TemplatifyPage(
 		"list",
 		templateTags,
 	); err != nil {
-		log.Fatal(err)
+		return err
 	}
 	return os.WriteFile(fmt.Sprintf("%s-%d.html", filepath.Join(ConfigData.BaseDir, filenamePrefix), page), buf.Bytes(), 0777)
 }
@@ -740,8 +953,7 @@ func WriteLatestPost(entry FrontMatter) error {
 		"latest-article",
 		toTemplateVariables(&entry, ""),
 	); err != nil {
-		fmt.Printf("Couldn't write the file1\n")
-		log.Fatal(err)
+		return err
 	}
 
 	filename := filepath.Join(ConfigData.BaseDir, "posts/page/welcome.html")
@@ -749,7 +961,7 @@ func WriteLatestPost(entry FrontMatter) error {
 	if err == nil {
 		replc := regexp.MustCompile(`<!-- START LAST(\n|.)*END LAST -->`)
 		mep := replc.ReplaceAll(mep, []byte(fmt.Sprintf(`<!-- START LAST -->%s<!-- END LAST -->`, buf)))
-		os.WriteFile(filename, mep, 0777)
+		err = os.WriteFile(filename, mep, 0777)
 	}
 
 	return err
@@ -758,8 +970,12 @@ func WriteLatestPost(entry FrontMatter) error {
 func init() {
 	rootCmd.AddCommand(updateCmd)
 	updateCmd.Flags().BoolVarP(&FullRegenerate, "fullregenerate", "f", false, "Do a full regeneration of the site")
+	updateCmd.Flags().BoolVarP(&HashRegenerate, "hash", "H", false, "Rebuild whatever changed since the last build by comparing file hashes, instead of the git diff")
+	updateCmd.Flags().IntVarP(&Jobs, "jobs", "", runtime.NumCPU(), "How many posts to render at the same time")
 	updateCmd.Flags().BoolVarP(&Silent, "silent", "s", false, "Run silently")
 	updateCmd.Flags().BoolVarP(&Totals, "totals", "t", false, "Show totals")
+	updateCmd.Flags().BoolVarP(&DryRun, "dry-run", "n", false, "Print what the update would do without pulling, writing or crossposting")
+	updateCmd.Flags().BoolVarP(&PlanAsJSON, "json", "j", false, "Print the dry run plan as JSON")
 }
 
 func ClearDir(dir string) error {
@@ -867,7 +1083,7 @@ func FileCopy(source, destination string) error {
 	if _, err := os.Stat(destination); os.IsNotExist(err) {
 		err = os.MkdirAll(targetDir, 0755)
 		if err != nil {
-			log.Fatalf("Failed making root dirs for %s, %v\n", targetDir, err)
+			return fmt.Errorf("failed making root dirs for %s, %v", targetDir, err)
 		}
 	}
 	var data, err1 = os.ReadFile(source)
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"html/template"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -81,7 +82,7 @@ func TestGetTargetFilenameFromPost(t *testing.T) {
 		ConfigData.RepositoryDir = testroot
 		ConfigData.BaseURL = "https://vonexplaino.com/blog/"
 		ConfigData.TemplateDir = filepath.Clean(testdataloader.GetBasePath() + `/../templates/`)
-		filename, _ := getTargetFilenameFromPost(thing.filename, make(map[string]struct{}))
+		filename, _, _ := getTargetFilenameFromPost(thing.filename, make(map[string]struct{}))
 
 		_, ok := filename[thing.expected]
 		// if !reflect.DeepEqual(tags, thing.expected) {
@@ -134,6 +135,74 @@ func TestCreatePageAndRSSForTags(t *testing.T) {
 	}
 }
 
+func TestTagsRebuiltFromEveryPost(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest := buildReport, siteManifest
+	t.Cleanup(func() { buildReport, siteManifest = previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.PerPage = 10
+	for _, stale := range []string{"tag/gone.xml", "tag/gone.atom", "tag/gone-1.html", "archive/tag/gone-1.xml", "tag/code-2.html", "tag/code-review-1.html"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(ConfigData.BaseDir, stale)), 0755)
+		os.WriteFile(filepath.Join(ConfigData.BaseDir, stale), []byte("old"), 0666)
+	}
+	one := justParseFrontMatter("Title: One\nTags: [code]\nCreated: 2024-05-01T10:00:00+1000")
+	one.Link = "https://vonexplaino.com/blog/posts/article/2024/05/one.html"
+	two := justParseFrontMatter("Title: Two\nTags: [code]\nCreated: 2024-05-02T10:00:00+1000")
+	two.Link = "https://vonexplaino.com/blog/posts/article/2024/05/two.html"
+	// Two was tagged gone before it was edited, and one is only in the main feed
+	siteManifest.Entries["posts/article/two.md"] = ManifestEntry{Tags: two.Tags, FrontMatter: two}
+	postsById := map[string]Item{one.Link: PostToItem(one), two.Link: PostToItem(two)}
+
+	tags := completeTags(map[string][]FrontMatter{"code": {two, two}, "gone": {two}}, postsById)
+	if len(tags["code"]) != 2 || len(tags["gone"]) != 0 {
+		t.Fatalf("Wrong posts for the tags %v", tags)
+	}
+	tags["code"] = append(tags["code"], two)
+	createPageAndRSSForTags(tags)
+	if buildReport.failed() {
+		t.Fatalf("Tags failed %s", buildReport.Summary())
+	}
+	feed, _ := ReadRSS(filepath.Join(ConfigData.BaseDir, "tag/code.xml"))
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("Posts repeated in the tag feed %v", feed.Channel.Items)
+	}
+	for file, exists := range map[string]bool{
+		"tag/code-1.html":        true,
+		"tag/code-2.html":        false,
+		"tag/code-review-1.html": true,
+		"tag/gone.xml":           false,
+		"tag/gone.atom":          false,
+		"tag/gone-1.html":        false,
+		"archive/tag/gone-1.xml": false,
+	} {
+		if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, file)); (err == nil) != exists {
+			t.Fatalf("%s should exist %t, %v", file, exists, err)
+		}
+	}
+}
+
+func TestTagsWithoutManifest(t *testing.T) {
+	previousManifest := siteManifest
+	t.Cleanup(func() { siteManifest = previousManifest })
+	siteManifest = newManifest()
+	siteManifest.Partial = true
+	one := justParseFrontMatter("Title: One\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000")
+	one.Link = "https://vonexplaino.com/blog/posts/article/2024/05/one.html"
+	postsById := map[string]Item{one.Link: PostToItem(one)}
+
+	tags := completeTags(map[string][]FrontMatter{"code": {}, "gone": {}}, postsById)
+	if len(tags["code"]) != 1 {
+		t.Fatalf("Post in the main feed not matched to its tag %v", tags)
+	}
+	// Without the manifest there's no telling the tag has no posts left
+	if _, ok := tags["gone"]; ok {
+		t.Fatalf("Tag emptied without a manifest %v", tags)
+	}
+}
+
 func TestPopulateAllGitFiles(t *testing.T) {
 	a, b := PopulateAllGitFiles(filepath.Clean(testdataloader.GetBasePath() + `/../features/tests/gits/`))
 	if b != nil {
@@ -429,6 +498,50 @@ func TestUpdateChangedRegenerateAdded(t *testing.T) {
 
 	// Posts from RSS too
 }
+
+func TestUpdateChangedRegenerateTwiceWithoutManifest(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousReport, previousManifest, previousGit := buildReport, siteManifest, gitCommand
+	t.Cleanup(func() { buildReport, siteManifest, gitCommand = previousReport, previousManifest, previousGit })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.TempDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.PerPage = 10
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/one.md": "---\nTitle: One\nTags: [code]\nCreated: 2024-05-01T10:00:00+1000\nType: article\nSlug: one\n---\nEdited",
+	})
+	// Only one post changed, the other two are only in the all posts feed
+	gitCommand = filepath.Join(t.TempDir(), "git.sh")
+	os.WriteFile(gitCommand, []byte("#!/bin/sh\nif [ \"$1\" = \"diff\" ]; then printf 'M\\tposts/one.md\\n'; fi\n"), 0755)
+	allPosts := RSS{}
+	for _, name := range []string{"one", "two", "three"} {
+		post := justParseFrontMatter("Title: " + name + "\nTags: [code]\nCreated: 2024-05-01T10:00:00+1000")
+		post.Link = "https://vonexplaino.com/blog/posts/article/2024/05/" + name + ".html"
+		allPosts.Channel.Items = append(allPosts.Channel.Items, PostToItem(post))
+	}
+	if err := WriteRSS(allPosts, "/all-rss.xml", -1); err != nil {
+		t.Fatalf("Couldn't write the RSS file %v", err)
+	}
+
+	for run := 1; run <= 2; run++ {
+		allPosts, _, postsById, _, _, err := updateChangedRegenerate()
+		if err != nil {
+			t.Fatalf("Run %d failed %v", run, err)
+		}
+		regenerateIndexAndRSS(allPosts, postsById)
+		writeSiteManifest()
+		feed, _ := ReadRSS(filepath.Join(ConfigData.BaseDir, "all-rss.xml"))
+		if len(feed.Channel.Items) != 3 {
+			t.Fatalf("Run %d lost posts from the feed %v", run, feed.Channel.Items)
+		}
+	}
+	if !siteManifest.Partial {
+		t.Fatalf("Manifest from changed runs should stay partial")
+	}
+}
+
 func TestMastodonPostCheck(t *testing.T) {
 	// When parsing a post, check if the Mastodon syndication is set, but empty.
 	if !postWantsMastodonCrosspost(FrontMatter{SyndicationLinks: SyndicationLinksS{Mastodon: "XPOST"}}) {
@@ -481,11 +594,124 @@ func TestUpdatePostToHost(t *testing.T) {
 	// Post it back to Bitbucket.
 }
 
+func TestRenderMDFilesInParallel(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	files := map[string]string{}
+	names := []string{"media/image.png"}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("posts/article/post%d.md", i)
+		names = append(names, name)
+		files[name] = fmt.Sprintf("---\nTitle: Post %d\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\n"+
+			"<section class=\"gallery\" markdown=\"1\">\n[![One](one.png \"One\")](one.png)\n</section>\n"+
+			"<section class=\"gallery\" markdown=\"1\">\n[![Two](two.png \"Two\")](two.png)\n</section>\nBody %d", i, i)
+	}
+	ConfigData.RepositoryDir = writeTestRepository(t, files)
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+
+	serial := renderMDFiles(names, 1)
+	parallel := renderMDFiles(names, 8)
+	if serial[0].html != "" || parallel[0].html != "" {
+		t.Fatalf("Rendered a non-markdown file")
+	}
+	for i := range names[1:] {
+		if serial[i+1].html != parallel[i+1].html || serial[i+1].err != nil {
+			t.Fatalf("Parallel render of %s differs\n%s\n%s", names[i+1], serial[i+1].html, parallel[i+1].html)
+		}
+	}
+	if !strings.Contains(serial[1].html, `id="gallery-2020-4-1-0"`) {
+		t.Fatalf("Gallery index not counted per page %s", serial[1].html)
+	}
+}
+
+func TestRetiredPostsLeaveListsAndFeeds(t *testing.T) {
+	keepConfig(t)
+	useTestTemplates(t)
+	previousDate, previousReport, previousManifest := DateOfExecution, buildReport, siteManifest
+	t.Cleanup(func() { DateOfExecution, buildReport, siteManifest = previousDate, previousReport, previousManifest })
+	buildReport, siteManifest = newBuildReport(), newManifest()
+	ConfigData.RepositoryDir = writeTestRepository(t, map[string]string{
+		"posts/article/live.md":     "---\nTitle: Live\nTags: [Code]\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+		"posts/article/retired.md":  "---\nTitle: Retired\nTags: [Code]\nStatus: retired\nCreated: 2024-05-01T10:00:00+1000\n---\nBody",
+		"posts/article/expiring.md": "---\nTitle: Expiring\nTags: [Lego]\nCreated: 2024-05-01T10:00:00+1000\nExpires: 2024-06-01T10:00:00+1000\n---\nBody",
+	})
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	DateOfExecution, _ = time.Parse(time.RFC3339, "2024-05-15T00:00:00+10:00")
+
+	changes := GitDiffs{Added: []string{"posts/article/live.md", "posts/article/retired.md", "posts/article/expiring.md"}}
+	tags, postsById := processFileUpdates(changes, map[string][]FrontMatter{}, map[string]Item{})
+	if len(postsById) != 2 || len(tags["code"]) != 1 || len(siteManifest.tagged("code")) != 1 {
+		t.Fatalf("Retired post is still listed %v %v", postsById, tags)
+	}
+	if _, err := os.Stat(filepath.Join(ConfigData.BaseDir, "posts/article/2024/05/retired.html")); err != nil {
+		t.Fatalf("Retired post page wasn't written %v", err)
+	}
+	if len(siteManifest.expired(DateOfExecution)) != 0 {
+		t.Fatalf("Expired too early %v", siteManifest.expired(DateOfExecution))
+	}
+
+	// The next update after it expires retires it
+	DateOfExecution = DateOfExecution.AddDate(0, 1, 0)
+	changes = addExpired(GitDiffs{Modified: []string{"posts/article/live.md"}})
+	if strings.Join(changes.Modified, ",") != "posts/article/live.md,posts/article/expiring.md" {
+		t.Fatalf("Expired post not rebuilt %v", changes.Modified)
+	}
+	tags, postsById = processFileUpdates(changes, map[string][]FrontMatter{}, postsById)
+	if _, ok := tags["lego"]; !ok || len(siteManifest.retag(tags)) != 1 || len(postsById) != 1 {
+		t.Fatalf("Expired post is still listed %v %v", postsById, siteManifest.retag(tags))
+	}
+	if len(siteManifest.postsById()) != 1 || len(siteManifest.expired(DateOfExecution)) != 0 {
+		t.Fatalf("Manifest still has the expired post listed %v", siteManifest.postsById())
+	}
+	vars := toTemplateVariables(&FrontMatter{Status: "retired"}, "")
+	if vars["retired"] != true {
+		t.Fatalf("Retired banner not set %v", vars)
+	}
+}
+
 func justParseFrontMatter(front string) FrontMatter {
 	x, _ := parseFrontMatter(front, "")
 	return x
 }
 
+// useTestTemplates swaps in a minimal set of templates for the test
+func useTestTemplates(t *testing.T) {
+	previous := templ
+	templ = template.Must(template.New("base").Funcs(template.FuncMap{"html": rawHTML}).Parse(
+		`{{define "article"}}<h1>{{.title}}</h1>{{html .content}}{{end}}` +
+			`{{define "page"}}<h1>{{.title}}</h1>{{html .content}}{{end}}` +
+			`{{define "toot"}}{{html .content}}{{end}}` +
+			`{{define "episode"}}<h1>{{.title}}</h1>{{html .content}}{{end}}` +
+			`{{define "list"}}{{range .list}}<a href="{{.link}}">{{.title}}</a>{{end}}{{end}}` +
+			`{{define "latest-article"}}{{.title}}{{end}}` +
+			`{{define "blogroll"}}{{range .categories}}<h2>{{.Name}}</h2>{{range .Entries}}<a href="{{.Site}}">{{.Title}}</a>{{end}}{{end}}{{end}}` +
+			`{{define "tag-related-tags"}}{{end}}`))
+	t.Cleanup(func() { templ = previous })
+}
+
+// keepConfig puts ConfigData back the way it was once the test is done
+func keepConfig(t *testing.T) {
+	previous := ConfigData
+	t.Cleanup(func() { ConfigData = previous })
+}
+
+// writeTestRepository makes a repository with the given files under a temp dir
+func writeTestRepository(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for _, d := range []string{"posts", "media"} {
+		os.MkdirAll(filepath.Join(dir, d), 0755)
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := os.WriteFile(filename, []byte(content), 0666); err != nil {
+			t.Fatalf("Couldn't write test file %s %v", filename, err)
+		}
+	}
+	return dir
+}
+
 func copy(source, destination string) error {
 	var err error = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
 		var relPath string = strings.Replace(path, source, "", 1)
@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// validateFeedsCmd checks the feeds a build wrote, before subscribers see them
+var validateFeedsCmd = &cobra.Command{
+	Use:   "validate-feeds",
+	Short: "Check every feed in the blog",
+	Long: `Parses every RSS, Atom and JSON feed under the BaseDir and checks it against the RSS 2.0, Atom and JSON Feed rules: required elements, dates, unique ids, absolute links, declared namespaces and item limits.
+
+Prints the problems found, and exits with 1 if there were any.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems, checked, err := validateFeeds(ConfigData.BaseDir)
+		if err != nil {
+			fmt.Printf("Could not read the feeds in %s %v\n", ConfigData.BaseDir, err)
+			os.Exit(1)
+		}
+		for _, problem := range problems {
+			fmt.Printf("  %s: %s\n", problem.File, problem.Error)
+		}
+		fmt.Printf("%d feeds checked, %d problems\n", checked, len(problems))
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateFeedsCmd)
+}
+
+// validateFeeds checks every feed under the directory, returning the
+// problems and how many feeds were checked
+func validateFeeds(dir string) ([]BuildError, int, error) {
+	problems := []BuildError{}
+	checked := 0
+	// The blog is usually a link to the latest build
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return problems, checked, err
+	}
+	err = filepath.WalkDir(root, func(filename string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relative, _ := filepath.Rel(root, filename)
+		relative = filepath.ToSlash(relative)
+		var found []string
+		var isFeed bool
+		switch filepath.Ext(filename) {
+		case ".xml", ".atom":
+			found, isFeed = validateXMLFeed(filename, feedItemLimit(relative))
+		case ".json":
+			found, isFeed = validateJSONFeed(filename, feedItemLimit(relative))
+		}
+		if isFeed {
+			checked++
+		}
+		for _, problem := range found {
+			problems = append(problems, BuildError{File: relative, Stage: "validate", Error: problem})
+		}
+		return nil
+	})
+	return problems, checked, err
+}
+
+// feedItemLimit is the most items a feed should have, -1 for no limit
+func feedItemLimit(relative string) int {
+	switch {
+	case relative == "rss.xml" || relative == "atom.xml" || relative == "feed.json":
+		return latestFeedLimit
+	case strings.HasPrefix(relative, "tag/") || strings.HasPrefix(relative, "type/") || strings.HasPrefix(relative, "archive/"):
+		return listFeedLimit
+	}
+	return -1
+}
+
+// validateXMLFeed checks an RSS or Atom feed, false if the file isn't a feed
+func validateXMLFeed(filename string, limit int) ([]string, bool) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return []string{err.Error()}, true
+	}
+	root, problems := scanXML(content)
+	switch root {
+	case "rss":
+		return append(problems, validateRSS(filename, content, limit)...), true
+	case "feed":
+		return append(problems, validateAtom(content, limit)...), true
+	case "":
+		return problems, true
+	}
+	return nil, false
+}
+
+// scanXML checks the XML is well formed, every prefix is declared and every
+// link is absolute, returning the name of the root element
+func scanXML(content []byte) (string, []string) {
+	problems := []string{}
+	root := ""
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	declared := []map[string]bool{{"xml": true}}
+	undeclared := map[string]bool{}
+	isDeclared := func(prefix string) bool {
+		for _, scope := range declared {
+			if scope[prefix] {
+				return true
+			}
+		}
+		return false
+	}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return root, append(problems, fmt.Sprintf("not well formed XML %v", err))
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root == "" {
+				root = t.Name.Local
+			}
+			scope := map[string]bool{}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					scope[attr.Name.Local] = true
+				}
+			}
+			declared = append(declared, scope)
+			names := []xml.Name{t.Name}
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "xmlns" {
+					names = append(names, attr.Name)
+				}
+				if (attr.Name.Local == "href" || attr.Name.Local == "url") && !isAbsoluteURL(attr.Value) {
+					problems = append(problems, fmt.Sprintf("%s link isn't absolute %s", t.Name.Local, attr.Value))
+				}
+			}
+			for _, name := range names {
+				if name.Space != "" && !isDeclared(name.Space) && !undeclared[name.Space] {
+					undeclared[name.Space] = true
+					problems = append(problems, fmt.Sprintf("namespace prefix %s isn't declared", name.Space))
+				}
+			}
+		case xml.EndElement:
+			declared = declared[:len(declared)-1]
+		}
+	}
+	if root == "" {
+		problems = append(problems, "no root element")
+	}
+	return root, problems
+}
+
+func isAbsoluteURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
+
+func validateRSS(filename string, content []byte, limit int) []string {
+	problems := []string{}
+	feed, err := ReadRSS(filename)
+	if err != nil {
+		return append(problems, fmt.Sprintf("could not read the feed %v", err))
+	}
+	// ReadRSS lets the atom:link elements overwrite the channel link
+	var links struct {
+		Links []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:"channel>link"`
+	}
+	xml.Unmarshal(content, &links)
+	feed.Channel.Link = ""
+	for _, link := range links.Links {
+		if link.XMLName.Space == "" {
+			feed.Channel.Link = link.Value
+		}
+	}
+	if feed.Version != "2.0" {
+		problems = append(problems, "version isn't 2.0")
+	}
+	channel := feed.Channel
+	for _, required := range []struct{ name, value string }{
+		{"title", channel.Title},
+		{"link", channel.Link},
+		{"description", channel.Description},
+	} {
+		if strings.TrimSpace(required.value) == "" {
+			problems = append(problems, "channel has no "+required.name)
+		}
+	}
+	if channel.Link != "" && !isAbsoluteURL(channel.Link) {
+		problems = append(problems, "channel link isn't absolute "+channel.Link)
+	}
+	if channel.LastBuildDate != "" {
+		if _, err := time.Parse(time.RFC1123Z, channel.LastBuildDate); err != nil {
+			problems = append(problems, "bad lastBuildDate "+channel.LastBuildDate)
+		}
+	}
+	if limit > -1 && len(channel.Items) > limit {
+		problems = append(problems, fmt.Sprintf("%d items, more than %d", len(channel.Items), limit))
+	}
+	guids := map[string]bool{}
+	for _, item := range channel.Items {
+		name := item.GUID
+		if item.Title == "" && item.Description == "" {
+			problems = append(problems, fmt.Sprintf("item %s has no title or description", name))
+		}
+		if item.GUID == "" {
+			problems = append(problems, fmt.Sprintf("item %s has no guid", item.Title))
+		} else if guids[item.GUID] {
+			problems = append(problems, "duplicate guid "+item.GUID)
+		} else if !isAbsoluteURL(item.GUID) {
+			problems = append(problems, "guid isn't an absolute link "+item.GUID)
+		}
+		guids[item.GUID] = true
+		if item.PubDateAsDate.IsZero() || item.PubDateAsDate.Format(time.RFC1123Z) != item.PublicationDate {
+			problems = append(problems, fmt.Sprintf("item %s has a bad pubDate %s", name, item.PublicationDate))
+		}
+		if item.Comments != "" && !isAbsoluteURL(item.Comments) {
+			problems = append(problems, fmt.Sprintf("item %s comments isn't absolute %s", name, item.Comments))
+		}
+		for _, enclosure := range item.Enclosures {
+			if enclosure.Type == "" || enclosure.Length <= 0 {
+				problems = append(problems, fmt.Sprintf("item %s enclosure %s has no type or length", name, enclosure.URL))
+			}
+		}
+	}
+	return problems
+}
+
+func validateAtom(content []byte, limit int) []string {
+	problems := []string{}
+	var feed AtomFeed
+	if err := xml.Unmarshal(content, &feed); err != nil {
+		return append(problems, fmt.Sprintf("could not read the feed %v", err))
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" {
+		problems = append(problems, "feed isn't in the Atom namespace")
+	}
+	if feed.ID == "" || feed.Title == "" {
+		problems = append(problems, "feed has no id or title")
+	}
+	if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		problems = append(problems, "bad feed updated "+feed.Updated)
+	}
+	self := false
+	for _, link := range feed.Links {
+		self = self || link.Rel == "self"
+	}
+	if !self {
+		problems = append(problems, "feed has no self link")
+	}
+	if limit > -1 && len(feed.Entries) > limit {
+		problems = append(problems, fmt.Sprintf("%d entries, more than %d", len(feed.Entries), limit))
+	}
+	ids := map[string]bool{}
+	for _, entry := range feed.Entries {
+		if entry.ID == "" || entry.Title == "" && entry.Summary == nil {
+			problems = append(problems, fmt.Sprintf("entry %s has no id or title", entry.ID))
+		}
+		if ids[entry.ID] {
+			problems = append(problems, "duplicate id "+entry.ID)
+		}
+		ids[entry.ID] = true
+		if _, err := time.Parse(time.RFC3339, entry.Updated); err != nil {
+			problems = append(problems, fmt.Sprintf("entry %s has a bad updated %s", entry.ID, entry.Updated))
+		}
+		if entry.Published != "" {
+			if _, err := time.Parse(time.RFC3339, entry.Published); err != nil {
+				problems = append(problems, fmt.Sprintf("entry %s has a bad published %s", entry.ID, entry.Published))
+			}
+		}
+	}
+	return problems
+}
+
+// validateJSONFeed checks a JSON Feed, false if the file isn't one
+func validateJSONFeed(filename string, limit int) ([]string, bool) {
+	problems := []string{}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return append(problems, err.Error()), true
+	}
+	var feed JSONFeed
+	if err := json.Unmarshal(content, &feed); err != nil || !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+		// The manifest, build report and such
+		return nil, false
+	}
+	if feed.Title == "" {
+		problems = append(problems, "feed has no title")
+	}
+	for _, link := range []string{feed.HomePageURL, feed.FeedURL} {
+		if link != "" && !isAbsoluteURL(link) {
+			problems = append(problems, "link isn't absolute "+link)
+		}
+	}
+	if limit > -1 && len(feed.Items) > limit {
+		problems = append(problems, fmt.Sprintf("%d items, more than %d", len(feed.Items), limit))
+	}
+	ids := map[string]bool{}
+	for _, item := range feed.Items {
+		if item.ID == "" {
+			problems = append(problems, fmt.Sprintf("item %s has no id", item.URL))
+		} else if ids[item.ID] {
+			problems = append(problems, "duplicate id "+item.ID)
+		}
+		ids[item.ID] = true
+		for _, link := range []string{item.URL, item.Image} {
+			if link != "" && !isAbsoluteURL(link) {
+				problems = append(problems, fmt.Sprintf("item %s link isn't absolute %s", item.ID, link))
+			}
+		}
+		if _, err := time.Parse(time.RFC3339, item.DatePublished); err != nil {
+			problems = append(problems, fmt.Sprintf("item %s has a bad date_published %s", item.ID, item.DatePublished))
+		}
+	}
+	return problems, true
+}
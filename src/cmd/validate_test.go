@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateFeeds(t *testing.T) {
+	keepConfig(t)
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.Metadata.Title = "Professor von Explaino"
+	ConfigData.Metadata.Description = "Steampunk and code"
+	ConfigData.Metadata.Webmaster = `professor@vonexplaino.com (Colin Morris)`
+	os.MkdirAll(filepath.Join(ConfigData.BaseDir, "tag"), 0755)
+	created, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	posts := []FrontMatter{
+		{Title: "Older", Link: "https://vonexplaino.com/blog/posts/article/2024/05/older.html", Tags: []string{"Code"}, CreatedDate: created, Synopsis: "Old one"},
+	}
+	rss := RSS{Channel: Channel{Title: "Tagged Code", Link: "https://vonexplaino.com/blog/tag/code-1.html", Description: "Code posts"}}
+	for _, post := range posts {
+		rss.Channel.Items = append(rss.Channel.Items, PostToItem(post))
+	}
+	WriteRSS(rss, "tag/code.xml", -1)
+	WriteAtom(PostsToAtom(posts, "Tagged Code", "Code posts", "https://vonexplaino.com/blog/tag/code-1.html"), "tag/code.atom", -1)
+	WriteJSONFeed(PostsToJSONFeed(posts, "Tagged Code", "Code posts", "https://vonexplaino.com/blog/tag/code-1.html"), "tag/code.json", -1)
+	os.WriteFile(filepath.Join(ConfigData.BaseDir, "manifest.json"), []byte(`{"entries":{}}`), 0777)
+
+	problems, checked, err := validateFeeds(ConfigData.BaseDir)
+	if err != nil || checked != 3 || len(problems) != 0 {
+		t.Fatalf("Good feeds failed %d %v %v", checked, problems, err)
+	}
+
+	item := `<item><title>One</title><link>https://vonexplaino.com/blog/one.html</link><guid>https://vonexplaino.com/blog/one.html</guid><pubDate>Wed, 01 May 2024 10:00:00 +1000</pubDate></item>`
+	items := strings.Repeat(item, latestFeedLimit+1)
+	items = strings.Replace(items, "Wed, 01 May", "Thu, 01 May", 1)
+	os.WriteFile(filepath.Join(ConfigData.BaseDir, "rss.xml"), []byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Bad</title><link>/blog/</link><description>Bad</description><rssTags:subject>Code</rssTags:subject>`+items+`</channel></rss>`), 0777)
+	problems, _, _ = validateFeeds(ConfigData.BaseDir)
+	for _, expected := range []string{
+		"channel link isn't absolute /blog/",
+		"namespace prefix rssTags isn't declared",
+		"11 items, more than 10",
+		"duplicate guid https://vonexplaino.com/blog/one.html",
+		"item https://vonexplaino.com/blog/one.html has a bad pubDate Thu, 01 May 2024 10:00:00 +1000",
+	} {
+		found := false
+		for _, problem := range problems {
+			found = found || (problem.File == "rss.xml" && problem.Error == expected)
+		}
+		if !found {
+			t.Fatalf("Missing %s from %v", expected, problems)
+		}
+	}
+}
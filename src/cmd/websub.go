@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Feeds written that differ from what the hub was last told about, with
+// their new hashes
+var changedFeeds = map[string]string{}
+
+// What changes in a feed every build, whether or not its items do
+var feedBuildDate = regexp.MustCompile(`<lastBuildDate>[^<]*</lastBuildDate>`)
+
+// writeFeed writes a feed into the BaseDir. If the feed is one readers
+// subscribe to, and its content differs from the last the hub accepted, it's
+// queued for the WebSub hub. Its hash is only recorded once the hub has it.
+func writeFeed(filename string, content []byte, subscribable bool) error {
+	filename = strings.TrimPrefix(filename, "/")
+	if err := os.WriteFile(filepath.Join(ConfigData.BaseDir, filename), content, 0777); err != nil {
+		return err
+	}
+	hash := hashContent(feedBuildDate.ReplaceAll(content, nil))
+	if siteManifest.Feeds[filename] == hash {
+		delete(changedFeeds, filename)
+	} else if subscribable {
+		changedFeeds[filename] = hash
+	} else {
+		siteManifest.Feeds[filename] = hash
+	}
+	return nil
+}
+
+// hubLinks is the atom:link to the WebSub hub for feeds to carry, if there's a hub
+func hubLinks() []AtomLink {
+	if ConfigData.WebSub.Hub == "" {
+		return nil
+	}
+	return []AtomLink{{Href: ConfigData.WebSub.Hub, Rel: "hub"}}
+}
+
+// pingHub tells the WebSub hub about every feed that changed, recording the
+// hashes of those it accepted. True if it accepted any.
+func pingHub() bool {
+	if ConfigData.WebSub.Hub == "" || NoCrosspost {
+		return false
+	}
+	accepted := false
+	feeds := []string{}
+	for filename := range changedFeeds {
+		feeds = append(feeds, filename)
+	}
+	sort.Strings(feeds)
+	for _, filename := range feeds {
+		feedLink, _ := url.JoinPath(ConfigData.BaseURL, filename)
+		err := publishToHub(feedLink)
+		if err == nil {
+			siteManifest.Feeds[filename] = changedFeeds[filename]
+			delete(changedFeeds, filename)
+			accepted = true
+		}
+		buildReport.add(filename, "websub", err)
+	}
+	return accepted
+}
+
+// publishToHub sends the hub a publish notification for the feed
+func publishToHub(feedLink string) error {
+	data := url.Values{
+		"hub.mode": {"publish"},
+		"hub.url":  {feedLink},
+	}
+	request, err := http.NewRequest(
+		"POST",
+		ConfigData.WebSub.Hub,
+		bytes.NewBuffer([]byte(data.Encode())),
+	)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-type", "application/x-www-form-urlencoded")
+	resp, err := Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the hub %s refused %s [%d]", ConfigData.WebSub.Hub, feedLink, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinmo/vonblog/utils/mocks"
+)
+
+func TestPingHub(t *testing.T) {
+	keepConfig(t)
+	previousManifest, previousReport, previousClient := siteManifest, buildReport, Client
+	t.Cleanup(func() {
+		siteManifest, buildReport, Client = previousManifest, previousReport, previousClient
+		changedFeeds = map[string]string{}
+	})
+	siteManifest = newManifest()
+	buildReport = newBuildReport()
+	changedFeeds = map[string]string{}
+	ConfigData.BaseDir = t.TempDir()
+	ConfigData.BaseURL = "https://vonexplaino.com/blog/"
+	ConfigData.WebSub.Hub = "https://hub.example.com/"
+	pinged := []string{}
+	Client = &mocks.MockClient{}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		pinged = append(pinged, req.URL.String()+" "+string(body))
+		return &http.Response{StatusCode: 204, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	created, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:00+10:00")
+	write := func() {
+		rss := RSS{Channel: Channel{Items: []Item{PostToItem(FrontMatter{Title: "One", Link: "https://vonexplaino.com/blog/one.html", CreatedDate: created})}}}
+		WriteRSSArchive(rss, "/rss.xml", 1)
+	}
+
+	write()
+	pingHub()
+	if len(pinged) != 1 || pinged[0] != "https://hub.example.com/ hub.mode=publish&hub.url=https%3A%2F%2Fvonexplaino.com%2Fblog%2Frss.xml" {
+		t.Fatalf("Wrong pings %v", pinged)
+	}
+	content, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "rss.xml"))
+	if !strings.Contains(string(content), `<atom:link href="https://hub.example.com/" rel="hub"></atom:link>`) {
+		t.Fatalf("No hub link in the feed\n%s", content)
+	}
+	archive, _ := os.ReadFile(filepath.Join(ConfigData.BaseDir, "archive/rss-1.xml"))
+	if strings.Contains(string(archive), `rel="hub"`) {
+		t.Fatalf("Hub link in the archive\n%s", archive)
+	}
+
+	// Only the build date is different, so there's nothing to tell the hub
+	time.Sleep(time.Second)
+	write()
+	pingHub()
+	if len(pinged) != 1 {
+		t.Fatalf("Unchanged feed pinged %v", pinged)
+	}
+
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 500, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	accepted := siteManifest.Feeds["rss.xml"]
+	siteManifest.Feeds["rss.xml"] = "something older"
+	write()
+	if pingHub() {
+		t.Fatalf("Refused ping counted as accepted")
+	}
+	if len(buildReport.Errors) != 1 || buildReport.Errors[0].Stage != "websub" || changedFeeds["rss.xml"] != accepted {
+		t.Fatalf("Refused ping not reported %v", buildReport.Errors)
+	}
+	// The next build tries again, as the hub never got it
+	if siteManifest.Feeds["rss.xml"] != "something older" {
+		t.Fatalf("Refused feed recorded as sent %s", siteManifest.Feeds["rss.xml"])
+	}
+	mocks.GetDoFunc = func(req *http.Request) (*http.Response, error) {
+		pinged = append(pinged, req.URL.String())
+		return &http.Response{StatusCode: 204, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	changedFeeds = map[string]string{}
+	write()
+	if !pingHub() || len(pinged) != 2 || siteManifest.Feeds["rss.xml"] != accepted {
+		t.Fatalf("Refused feed not pinged again %v", pinged)
+	}
+}